@@ -1,9 +1,18 @@
 -- Добавление пользователей
-INSERT INTO "user" (id, mail, nickname, password, is_moderator, count_checks)
+INSERT INTO "user" (id, mail, nickname, password, is_moderator, is_admin, email_verified, count_checks)
 VALUES
-(1, 'user1@example.com', 'User1', '03ac674216f3e15c761ee1a5e255f067953623c8b388b4459e13f978d7c846f4', FALSE, 2),
-(2, 'user2@example.com', 'User2', '03ac674216f3e15c761ee1a5e255f067953623c8b388b4459e13f978d7c846f4', FALSE, 2),
-(3, 'moderator@example.com', 'ModUser', '03ac674216f3e15c761ee1a5e255f067953623c8b388b4459e13f978d7c846f4', TRUE, 2);
+(1, 'user1@example.com', 'User1', '$argon2id$v=19$m=65536,t=3,p=2$0eS2V2hsgXkEurQRq9cRIA$MMBcavO+Wi8vM+rxus2NOkk+gP/7nHF6ygHK/fohSIE', FALSE, FALSE, TRUE, 2),
+(2, 'user2@example.com', 'User2', '$argon2id$v=19$m=65536,t=3,p=2$QoZAZ9cLvJIeAPCMRNnr7g$v2OM+IF5zoyMATPaB0piO8b0653+N1SPlFOziA1Zoic', FALSE, FALSE, TRUE, 2),
+(3, 'moderator@example.com', 'ModUser', '$argon2id$v=19$m=65536,t=3,p=2$Dzdxg/kDG3yiTD384GcXiA$77pxjNXBOLBoWAj7svTXyxElJKukHRTs3Z5M07jSaxA', TRUE, TRUE, TRUE, 2);
+
+-- Добавление рубрик
+INSERT INTO rubric (id, code, title)
+VALUES
+(1, 'ege', 'ЕГЭ по русскому языку: сочинение');
+
+INSERT INTO rubric_version (id, rubric_id, version)
+VALUES
+(1, 1, 1);
 
 -- Добавление вариантов
 INSERT INTO variant (id, variant_text, variant_title, author_position, is_public)
@@ -96,6 +105,8 @@ VALUES
 
 
 
+UPDATE variant SET rubric_version_id = 1;
+
 -- Добавление эссе
 INSERT INTO essay (id, essay_text, completed_at, status, is_published, user_id, variant_id)
 VALUES
@@ -149,23 +160,23 @@ VALUES
 Таким образом, чтобы понять человека, одного первого впечатления недостаточно, ведь чаще всего оно не соответствует действительности. Неслучайно в народе говорят: «По одёжке не суди, по делам гляди».', '2025-01-04 12:00:00', 'draft', FALSE, 1, 4);
 
 -- Добавление критериев
-INSERT INTO criteria (id, title, max_score)
+INSERT INTO criteria (id, rubric_version_id, code, title, max_score)
 VALUES
-(1, 'Отражение позиции автора (рассказчика) по указанной проблеме исходного текста', 1),
-(2, 'Комментарий к позиции автора (рассказчика) по указанной проблеме исходного текста', 3),
-(3, 'Собственное отношение к позиции автора (рассказчика) по указанной проблеме исходного текста', 2),
-(4, 'Фактическая точность речи', 1),
-(5, 'Логичность речи', 2),
-(6, 'Соблюдение этических норм', 1),
-(7, 'Соблюдение орфографических норм', 3),
-(8, 'Соблюдение пунктуационных норм', 3),
-(9, 'Соблюдение грамматических норм', 3),
-(10, 'Соблюдение речевых норм', 3);
+(1, 1, 'K1', 'Отражение позиции автора (рассказчика) по указанной проблеме исходного текста', 1),
+(2, 1, 'K2', 'Комментарий к позиции автора (рассказчика) по указанной проблеме исходного текста', 3),
+(3, 1, 'K3', 'Собственное отношение к позиции автора (рассказчика) по указанной проблеме исходного текста', 2),
+(4, 1, 'K4', 'Фактическая точность речи', 1),
+(5, 1, 'K5', 'Логичность речи', 2),
+(6, 1, 'K6', 'Соблюдение этических норм', 1),
+(7, 1, 'K7', 'Соблюдение орфографических норм', 3),
+(8, 1, 'K8', 'Соблюдение пунктуационных норм', 3),
+(9, 1, 'K9', 'Соблюдение грамматических норм', 3),
+(10, 1, 'K10', 'Соблюдение речевых норм', 3);
 
 -- Добавление результатов
-INSERT INTO result (id, sum_score, essay_id)
+INSERT INTO result (id, sum_score, essay_id, rubric_version_id)
 VALUES
-(1, 22, 1),
+(1, 22, 1, 1),
 
 -- Добавление результатов по критериям
 INSERT INTO result_criteria (result_id, criteria_id, score, explanation)
@@ -181,3 +192,12 @@ VALUES
 (1, 9, 3, 'Грамматических ошибок нет'),
 (1, 10, 3, 'Речевых ошибок нет');
 
+
+-- Первые версии текстов сочинений
+INSERT INTO essay_revision (essay_id, version, essay_text, created_at)
+SELECT id, version, essay_text, completed_at FROM essay;
+
+-- Сдвиг последовательностей после вставки с явными id
+SELECT setval('rubric_id_seq', (SELECT MAX(id) FROM rubric));
+SELECT setval('rubric_version_id_seq', (SELECT MAX(id) FROM rubric_version));
+SELECT setval('criteria_id_seq', (SELECT MAX(id) FROM criteria));
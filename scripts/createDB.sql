@@ -1,4 +1,4 @@
-CREATE TYPE STATUS AS ENUM ('draft', 'saved', 'checked', 'appeal', 'appealed');
+CREATE TYPE STATUS AS ENUM ('draft', 'saved', 'checked', 'appeal', 'appealed', 'failed');
 
 CREATE TABLE "user" (
     id SERIAL PRIMARY KEY,
@@ -6,15 +6,80 @@ CREATE TABLE "user" (
     nickname VARCHAR(100) NOT NULL,
     password VARCHAR(250) NOT NULL,
     is_moderator BOOLEAN DEFAULT FALSE,
+    is_admin BOOLEAN DEFAULT FALSE,
+    email_verified BOOLEAN DEFAULT FALSE,
     count_checks INTEGER DEFAULT 2
 );
 
+CREATE TABLE user_session (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    user_id INTEGER,
+    data BYTEA,
+    user_agent TEXT,
+    ip VARCHAR(64),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX user_session_user_idx ON user_session (user_id);
+CREATE INDEX user_session_expires_idx ON user_session (expires_at);
+
+CREATE TABLE refresh_token (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    family VARCHAR(64) NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX refresh_token_family_idx ON refresh_token (family);
+CREATE INDEX refresh_token_user_idx ON refresh_token (user_id);
+CREATE INDEX refresh_token_expires_idx ON refresh_token (expires_at);
+
+CREATE TABLE account_token (
+    id SERIAL PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL,
+    purpose VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX account_token_user_idx ON account_token (user_id, purpose);
+CREATE INDEX account_token_expires_idx ON account_token (expires_at);
+
+CREATE TABLE rubric (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    title TEXT NOT NULL
+);
+
+CREATE TABLE rubric_version (
+    id SERIAL PRIMARY KEY,
+    rubric_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    published_at TIMESTAMP DEFAULT NOW(),
+    UNIQUE (rubric_id, version),
+    FOREIGN KEY (rubric_id) REFERENCES rubric(id)
+);
+
 CREATE TABLE variant (
     id SERIAL PRIMARY KEY,
     variant_title TEXT,
     variant_text TEXT,
     author_position TEXT,
-    is_public BOOLEAN DEFAULT FALSE
+    is_public BOOLEAN DEFAULT FALSE,
+    rubric_version_id INTEGER,
+    FOREIGN KEY (rubric_version_id) REFERENCES rubric_version(id)
 );
 
 CREATE TABLE essay (
@@ -25,10 +90,61 @@ CREATE TABLE essay (
     is_published BOOLEAN DEFAULT FALSE,
     user_id INTEGER,
     variant_id INTEGER,
+    parent_essay_id INTEGER,
+    version INTEGER NOT NULL DEFAULT 1,
+    deleted_at TIMESTAMP,
+    archived_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES "user"(id),
+    FOREIGN KEY (variant_id) REFERENCES variant(id),
+    FOREIGN KEY (parent_essay_id) REFERENCES essay(id)
+);
+
+CREATE INDEX essay_parent_idx ON essay (parent_essay_id);
+CREATE INDEX essay_removed_idx ON essay (COALESCE(deleted_at, archived_at)) WHERE deleted_at IS NOT NULL OR archived_at IS NOT NULL;
+
+CREATE TABLE essay_status_history (
+    id SERIAL PRIMARY KEY,
+    essay_id INTEGER NOT NULL,
+    from_status STATUS NOT NULL,
+    to_status STATUS NOT NULL,
+    actor VARCHAR(20) NOT NULL,
+    actor_id INTEGER,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (essay_id) REFERENCES essay(id),
+    FOREIGN KEY (actor_id) REFERENCES "user"(id)
+);
+
+CREATE INDEX essay_status_history_essay_idx ON essay_status_history (essay_id, created_at);
+
+CREATE TABLE essay_revision (
+    id SERIAL PRIMARY KEY,
+    essay_id INTEGER NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    essay_text TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    FOREIGN KEY (essay_id) REFERENCES essay(id)
+);
+
+CREATE INDEX essay_revision_essay_idx ON essay_revision (essay_id, created_at);
+
+CREATE TABLE exam_session (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    essay_id INTEGER NOT NULL UNIQUE,
+    variant_id INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'active', -- active, submitted, expired
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    deadline_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES "user"(id),
+    FOREIGN KEY (essay_id) REFERENCES essay(id),
     FOREIGN KEY (variant_id) REFERENCES variant(id)
 );
 
+CREATE INDEX exam_session_user_idx ON exam_session (user_id, started_at);
+CREATE INDEX exam_session_open_idx ON exam_session (deadline_at) WHERE ended_at IS NULL;
+
 CREATE TABLE comment (
     id SERIAL PRIMARY KEY,
     user_id INTEGER,
@@ -52,13 +168,21 @@ CREATE TABLE result (
     sum_score INTEGER,
     appeal_text TEXT,
     essay_id INTEGER,
-    FOREIGN KEY (essay_id) REFERENCES essay(id)
+    attempt_id TEXT,
+    rubric_version_id INTEGER,
+    UNIQUE (essay_id, attempt_id),
+    FOREIGN KEY (essay_id) REFERENCES essay(id),
+    FOREIGN KEY (rubric_version_id) REFERENCES rubric_version(id)
 );
 
 CREATE TABLE criteria (
     id SERIAL PRIMARY KEY,
+    rubric_version_id INTEGER NOT NULL,
+    code VARCHAR(10) NOT NULL,
     title TEXT NOT NULL,
-    max_score INTEGER NOT NULL
+    max_score INTEGER NOT NULL,
+    UNIQUE (rubric_version_id, code),
+    FOREIGN KEY (rubric_version_id) REFERENCES rubric_version(id)
 );
 
 CREATE TABLE result_criteria (
@@ -69,4 +193,64 @@ CREATE TABLE result_criteria (
     PRIMARY KEY (result_id, criteria_id),
     FOREIGN KEY (result_id) REFERENCES result(id),
     FOREIGN KEY (criteria_id) REFERENCES criteria(id)
-);
\ No newline at end of file
+);
+
+CREATE TABLE outbox (
+    id SERIAL PRIMARY KEY,
+    essay_id INTEGER,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP DEFAULT NOW(),
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP DEFAULT NOW(),
+    sent_at TIMESTAMP,
+    FOREIGN KEY (essay_id) REFERENCES essay(id)
+);
+
+CREATE INDEX outbox_pending_idx ON outbox (next_attempt_at) WHERE status = 'pending';
+
+CREATE TABLE check_attempt (
+    id SERIAL PRIMARY KEY,
+    essay_id INTEGER NOT NULL,
+    attempt_id TEXT NOT NULL UNIQUE,
+    attempt_number INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP DEFAULT NOW(),
+    finished_at TIMESTAMP,
+    FOREIGN KEY (essay_id) REFERENCES essay(id)
+);
+CREATE TABLE appeal (
+    id SERIAL PRIMARY KEY,
+    essay_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'filed',
+    appeal_text TEXT,
+    moderator_id INTEGER,
+    claimed_at TIMESTAMP,
+    resolution_comment TEXT,
+    original_result_id INTEGER,
+    result_id INTEGER,
+    created_at TIMESTAMP DEFAULT NOW(),
+    resolved_at TIMESTAMP,
+    FOREIGN KEY (essay_id) REFERENCES essay(id),
+    FOREIGN KEY (user_id) REFERENCES "user"(id),
+    FOREIGN KEY (moderator_id) REFERENCES "user"(id),
+    FOREIGN KEY (original_result_id) REFERENCES result(id),
+    FOREIGN KEY (result_id) REFERENCES result(id)
+);
+
+CREATE INDEX appeal_open_idx ON appeal (status, created_at) WHERE status IN ('filed', 'claimed');
+CREATE INDEX appeal_user_created_idx ON appeal (user_id, created_at);
+
+CREATE TABLE appeal_criteria (
+    appeal_id INTEGER,
+    criteria_id INTEGER,
+    reason TEXT,
+    decision_score INTEGER,
+    decision_comment TEXT,
+    PRIMARY KEY (appeal_id, criteria_id),
+    FOREIGN KEY (appeal_id) REFERENCES appeal(id),
+    FOREIGN KEY (criteria_id) REFERENCES criteria(id)
+);
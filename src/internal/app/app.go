@@ -1,46 +1,141 @@
 package app
 
 import (
+	"essay/src/internal/checker"
 	"essay/src/internal/config"
 	"essay/src/internal/database"
+	"essay/src/internal/kafka"
+	"essay/src/internal/mailer"
 	"essay/src/internal/middleware"
 	"essay/src/internal/services"
 	"essay/src/internal/transport/handlers"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
 type App struct {
 	DB *database.DB
 
+	Checker        checker.Checker
+	CheckerConfig  *config.CheckerConfig
+	AppealConfig   *config.AppealConfig
+	TokenConfig    *config.TokenConfig
+	ResultConsumer *kafka.Consumer
+
 	UserService *services.UserService
 
 	UserHandler *handlers.UserHandler
 
 	stopChan chan struct{} // для graceful shutdown
+	workers  sync.WaitGroup
 }
 
 func NewApp() *App {
 	db := database.GetPostgreSQLConnection()
 
 	userService := services.NewUserService(db.Instance)
+	appealConfig := config.LoadAppealConfig()
+	userService.AppealRules = services.AppealRules{
+		Window:       appealConfig.Window,
+		MonthlyQuota: appealConfig.MonthlyQuota,
+	}
+	userService.EssayRetention = config.LoadEssayConfig().Retention
+	userService.ExamDuration = config.LoadExamConfig().Duration
+	tokenConfig := config.LoadTokenConfig()
+	userService.Tokens = services.TokenRules{
+		Key:          tokenConfig.Key,
+		AccessTTL:    tokenConfig.AccessTTL,
+		RefreshTTL:   tokenConfig.RefreshTTL,
+		VerifyTTL:    tokenConfig.VerifyTTL,
+		ResetTTL:     tokenConfig.ResetTTL,
+		MailCooldown: tokenConfig.MailCooldown,
+	}
+	mailConfig := config.LoadMailConfig()
+	userMailer, err := mailer.New(mailConfig)
+	if err != nil {
+		log.Fatal("Failed to create mailer:", err)
+	}
+	userService.Mailer = userMailer
+	userService.AppURL = mailConfig.AppURL
 
-	userHandler := handlers.NewUserHandler(userService)
+	checkerConfig := config.LoadCheckerConfig()
+	userService.OutboxRules = services.OutboxRules{
+		Lease:       checkerConfig.OutboxLease,
+		MaxAttempts: checkerConfig.OutboxMaxAttempts,
+	}
+	essayChecker, err := checker.New(checkerConfig, config.LoadKafkaConfig(), userService)
+	if err != nil {
+		log.Fatal("Failed to create essay checker:", err)
+	}
+
+	// результаты из Kafka читаем только если сочинения туда и отправляются
+	var resultConsumer *kafka.Consumer
+	if checkerConfig.Kind == "kafka" {
+		resultSource, err := kafka.NewKafkaSource(config.LoadKafkaConfig())
+		if err != nil {
+			log.Fatal("Failed to create Kafka consumer:", err)
+		}
+		resultConsumer = kafka.NewConsumer(resultSource, userService)
+	}
+
+	signatureVerifier := middleware.NewSignatureVerifier(checkerConfig.Secret, checkerConfig.SignatureWindow)
+	userHandler := handlers.NewUserHandler(userService, signatureVerifier)
 
 	app := &App{
-		DB:          db,
-		UserService: userService,
-		UserHandler: userHandler,
-		stopChan:    make(chan struct{}),
+		DB:             db,
+		Checker:        essayChecker,
+		CheckerConfig:  checkerConfig,
+		AppealConfig:   appealConfig,
+		TokenConfig:    tokenConfig,
+		ResultConsumer: resultConsumer,
+		UserService:    userService,
+		UserHandler:    userHandler,
+		stopChan:       make(chan struct{}),
+	}
+
+	// Читаем результаты проверки из Kafka
+	if resultConsumer != nil {
+		resultConsumer.Start()
 	}
 
 	// Запускаем периодический сброс проверок
-	go app.startCheckResetter()
+	app.startWorker(app.startCheckResetter)
+
+	// Отправляем сочинения из outbox на проверку
+	app.startWorker(app.startOutboxRelay)
+
+	// Повторяем или возвращаем зависшие проверки
+	app.startWorker(app.startCheckWatchdog)
+
+	// Возвращаем в очередь апелляции, забытые модераторами
+	app.startWorker(app.startAppealReleaser)
+
+	// Окончательно удаляем сочинения, которые не восстановили вовремя
+	app.startWorker(app.startEssayPurger)
+
+	// Отправляем на проверку сочинения экзаменационных сессий, время которых вышло
+	app.startWorker(app.startExamCloser)
+
+	// Удаляем истёкшие сессии, refresh-токены и ссылки из писем
+	app.startWorker(app.startSessionPurger)
+
+	// Отправляем письма восстановления пароля
+	app.startWorker(app.startPasswordResetSender)
 
 	return app
 }
 
+// startWorker runs a background loop that Close waits for.
+func (a *App) startWorker(worker func()) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		worker()
+	}()
+}
+
 func (a *App) startCheckResetter() {
 	ticker := time.NewTicker(24 * time.Hour)
 	defer ticker.Stop()
@@ -59,16 +154,153 @@ func (a *App) startCheckResetter() {
 	}
 }
 
+func (a *App) startOutboxRelay() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			delivered, err := a.UserService.RelayOutbox(50, a.Checker.Check)
+			if err != nil {
+				log.Printf("Error relaying outbox: %v", err)
+			} else if delivered > 0 {
+				log.Printf("Sent %d essays for checking", delivered)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startCheckWatchdog() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			retried, failed, err := a.UserService.RetryStuckChecks(a.CheckerConfig.SLA, a.CheckerConfig.MaxAttempts)
+			if err != nil {
+				log.Printf("Error retrying stuck checks: %v", err)
+			} else if retried > 0 || failed > 0 {
+				log.Printf("Stuck checks: %d sent again, %d failed and refunded", retried, failed)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startAppealReleaser() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			released, err := a.UserService.ReleaseStaleAppealClaims(a.AppealConfig.ClaimTimeout)
+			if err != nil {
+				log.Printf("Error releasing stale appeal claims: %v", err)
+			} else if released > 0 {
+				log.Printf("Released %d stale appeal claims", released)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startEssayPurger() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			purged, err := a.UserService.PurgeRemovedEssays(a.UserService.EssayRetention, 100)
+			if err != nil {
+				log.Printf("Error purging removed essays: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d removed essays", purged)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startExamCloser() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			closed, err := a.UserService.CloseExpiredExamSessions(100)
+			if err != nil {
+				log.Printf("Error closing exam sessions: %v", err)
+			} else if closed > 0 {
+				log.Printf("Closed %d exam sessions", closed)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startSessionPurger() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			purged, err := a.UserService.PurgeExpiredSessions()
+			if err != nil {
+				log.Printf("Error purging expired sessions: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired sessions", purged)
+			}
+			purged, err = a.UserService.PurgeExpiredRefreshTokens()
+			if err != nil {
+				log.Printf("Error purging expired refresh tokens: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired refresh tokens", purged)
+			}
+			purged, err = a.UserService.PurgeExpiredAccountTokens()
+			if err != nil {
+				log.Printf("Error purging expired account tokens: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired account tokens", purged)
+			}
+		case <-a.stopChan:
+			return
+		}
+	}
+}
+
+func (a *App) startPasswordResetSender() {
+	a.UserService.SendPasswordResets(a.stopChan)
+}
+
 func (a *App) Close() {
-	close(a.stopChan) // останавливаем горутину сброса проверок
+	close(a.stopChan) // останавливаем фоновые горутины
+	a.workers.Wait()
+	if a.ResultConsumer != nil {
+		a.ResultConsumer.Stop()
+	}
+	a.Checker.Close()
 	a.DB.Close()
 }
 
 func (a *App) ServeMux() http.Handler {
-	config.InitSessionStore()
+	config.SessionStore = services.NewSessionStore(a.DB.Instance, config.SessionOptions(), config.SessionKey())
 	mux := http.NewServeMux()
 
 	a.UserHandler.RegisterRoutes(mux)
 
-	return middleware.NewCORSMiddleware(config.СorsConfig)(mux)
+	// пользователь сессии или bearer-токена определяется один раз на запрос
+	handler := middleware.Authenticate(config.SessionStore, a.TokenConfig.Key)(mux)
+	return middleware.NewCORSMiddleware(config.СorsConfig)(handler)
 }
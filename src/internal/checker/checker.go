@@ -0,0 +1,35 @@
+package checker
+
+import (
+	"fmt"
+
+	"essay/src/internal/config"
+	"essay/src/internal/kafka"
+	"essay/src/internal/models"
+)
+
+// Checker sends an essay for checking. Results come back asynchronously
+// through the result consumer or the /result callback.
+type Checker interface {
+	Check(request models.EssayRequest) error
+	Close()
+}
+
+// New creates the checker selected by cfg.Kind. The stub checker stores its
+// results directly in sink.
+func New(cfg *config.CheckerConfig, kafkaCfg *config.KafkaConfig, sink kafka.ResultSink) (Checker, error) {
+	switch cfg.Kind {
+	case "kafka":
+		producer, err := kafka.NewProducer(kafkaCfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewKafkaChecker(producer), nil
+	case "http":
+		return NewHTTPChecker(cfg.URL), nil
+	case "stub":
+		return NewStubChecker(sink), nil
+	default:
+		return nil, fmt.Errorf("unknown checker %q", cfg.Kind)
+	}
+}
@@ -0,0 +1,86 @@
+package checker
+
+import (
+	"encoding/json"
+	"essay/src/internal/config"
+	"essay/src/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	results []models.CheckResult
+}
+
+func (s *recordingSink) SaveCheckResult(result *models.CheckResult) error {
+	s.results = append(s.results, *result)
+	return nil
+}
+
+func longEssay() string {
+	paragraph := strings.Repeat("Автор поднимает важную проблему дружбы и верности. ", 10)
+	return strings.Join([]string{paragraph, paragraph, paragraph + "Я считаю, что автор прав.", paragraph}, "\n")
+}
+
+func TestStubChecker_StoresDeterministicResult(t *testing.T) {
+	sink := &recordingSink{}
+	stub := NewStubChecker(sink)
+	request := models.EssayRequest{EssayID: 3, AttemptID: "a1", EssayText: longEssay()}
+
+	assert.NoError(t, stub.Check(request))
+	assert.NoError(t, stub.Check(request))
+
+	if assert.Len(t, sink.results, 2) {
+		assert.Equal(t, uint64(3), sink.results[0].EssayID)
+		assert.Equal(t, "a1", sink.results[0].AttemptID)
+		assert.Equal(t, sink.results[0], sink.results[1])
+	}
+}
+
+func TestScore(t *testing.T) {
+	result := Score(longEssay())
+
+	expected := map[string]int{"K1": 1, "K2": 3, "K3": 2, "K5": 2, "K10": 2}
+	for code, score := range expected {
+		c, ok := result.Criterion(code)
+		if assert.True(t, ok, code) {
+			assert.Equal(t, score, c.Score, code)
+		}
+	}
+
+	short := Score("Слишком короткое сочинение.")
+	if assert.Len(t, short.Criteria, 10) {
+		for _, c := range short.Criteria {
+			assert.Zero(t, c.Score, c.Code)
+		}
+		assert.NotEmpty(t, short.Criteria[0].Explanation)
+	}
+}
+
+func TestHTTPChecker(t *testing.T) {
+	var received models.EssayRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		if received.EssayID == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	httpChecker := NewHTTPChecker(server.URL)
+
+	assert.NoError(t, httpChecker.Check(models.EssayRequest{EssayID: 5, AttemptID: "a1"}))
+	assert.Equal(t, uint64(5), received.EssayID)
+	assert.Error(t, httpChecker.Check(models.EssayRequest{}))
+}
+
+func TestNew_UnknownChecker(t *testing.T) {
+	_, err := New(&config.CheckerConfig{Kind: "llm"}, &config.KafkaConfig{}, &recordingSink{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,45 @@
+package checker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"essay/src/internal/models"
+)
+
+// HTTPChecker posts essays to the checking service, which reports results
+// back through POST /result/{id}.
+type HTTPChecker struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPChecker(url string) *HTTPChecker {
+	return &HTTPChecker{
+		url:    url,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+func (c *HTTPChecker) Check(request models.EssayRequest) error {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal essay: %w", err)
+	}
+
+	resp, err := c.client.Post(c.url, "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return fmt.Errorf("failed to send request to checker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("error from checker: %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *HTTPChecker) Close() {}
@@ -0,0 +1,23 @@
+package checker
+
+import (
+	"essay/src/internal/kafka"
+	"essay/src/internal/models"
+)
+
+// KafkaChecker publishes essays to the check topic.
+type KafkaChecker struct {
+	producer kafka.EssayProducer
+}
+
+func NewKafkaChecker(producer kafka.EssayProducer) *KafkaChecker {
+	return &KafkaChecker{producer: producer}
+}
+
+func (c *KafkaChecker) Check(request models.EssayRequest) error {
+	return c.producer.ProduceEssay(request)
+}
+
+func (c *KafkaChecker) Close() {
+	c.producer.Close()
+}
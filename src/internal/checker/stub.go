@@ -0,0 +1,126 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"essay/src/internal/kafka"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+)
+
+// StubChecker scores essays with simple text rules and stores the result
+// right away. It needs no network and gives the same scores for the same text.
+type StubChecker struct {
+	sink kafka.ResultSink
+}
+
+func NewStubChecker(sink kafka.ResultSink) *StubChecker {
+	return &StubChecker{sink: sink}
+}
+
+func (c *StubChecker) Check(request models.EssayRequest) error {
+	err := c.sink.SaveCheckResult(&models.CheckResult{
+		EssayID:     request.EssayID,
+		AttemptID:   request.AttemptID,
+		LLMResponse: Score(request.EssayText),
+	})
+	if errors.Is(err, services.ErrResultExists) {
+		return nil
+	}
+	return err
+}
+
+func (c *StubChecker) Close() {}
+
+// Score returns plausible K1–K10 scores for the text.
+func Score(text string) models.DetailedResult {
+	words := strings.Fields(text)
+	if len(words) < services.MinEssayWords {
+		explanation := fmt.Sprintf("Заглушка: в сочинении меньше %d слов", services.MinEssayWords)
+		var result models.DetailedResult
+		for i := 1; i <= 10; i++ {
+			result.Criteria = append(result.Criteria, criterion(i, 0, explanation))
+		}
+		return result
+	}
+
+	paragraphs := services.CountParagraphs(text)
+	sentences := max(countSentences(text), 1)
+	avgSentence := len(words) / sentences
+
+	k1 := criterion(1, 1, "Заглушка: позиция автора сформулирована")
+	k4 := criterion(4, 1, "Заглушка: фактических ошибок не найдено")
+	k6 := criterion(6, 1, "Заглушка: этические нормы соблюдены")
+	k7 := criterion(7, 3, "Заглушка: орфография не проверялась")
+	k9 := criterion(9, 3, "Заглушка: грамматика не проверялась")
+
+	var k2, k3, k5, k8, k10 models.CriterionScore
+	switch {
+	case paragraphs >= 4:
+		k2 = criterion(2, 3, "Заглушка: комментарий развёрнут в нескольких абзацах")
+		k5 = criterion(5, 2, "Заглушка: текст разбит на абзацы")
+	case paragraphs >= 2:
+		k2 = criterion(2, 2, "Заглушка: комментарий недостаточно развёрнут")
+		k5 = criterion(5, 1, "Заглушка: мало абзацев")
+	default:
+		k2 = criterion(2, 1, "Заглушка: комментарий в одном абзаце")
+		k5 = criterion(5, 0, "Заглушка: текст не разбит на абзацы")
+	}
+
+	if hasOpinion(text) {
+		k3 = criterion(3, 2, "Заглушка: собственное отношение выражено")
+	} else {
+		k3 = criterion(3, 1, "Заглушка: собственное отношение выражено неявно")
+	}
+
+	if avgSentence <= 25 {
+		k8 = criterion(8, 3, "Заглушка: предложения умеренной длины")
+	} else {
+		k8 = criterion(8, 2, "Заглушка: слишком длинные предложения")
+	}
+
+	if lexicalDiversity(words) >= 0.5 {
+		k10 = criterion(10, 3, "Заглушка: лексика разнообразна")
+	} else {
+		k10 = criterion(10, 2, "Заглушка: много повторов")
+	}
+
+	return models.DetailedResult{
+		Criteria: []models.CriterionScore{k1, k2, k3, k4, k5, k6, k7, k8, k9, k10},
+	}
+}
+
+// criterion builds the score of criterion K<n>.
+func criterion(n, score int, explanation string) models.CriterionScore {
+	return models.CriterionScore{Code: fmt.Sprintf("K%d", n), Score: score, Explanation: explanation}
+}
+
+func countSentences(text string) int {
+	return len(strings.FieldsFunc(text, func(r rune) bool {
+		return r == '.' || r == '!' || r == '?'
+	}))
+}
+
+func hasOpinion(text string) bool {
+	lower := strings.ToLower(text)
+	for _, marker := range []string{"согласен", "согласна", "считаю", "по моему мнению", "по-моему", "я думаю"} {
+		if strings.Contains(lower, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func lexicalDiversity(words []string) float64 {
+	unique := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimFunc(word, func(r rune) bool { return !unicode.IsLetter(r) }))
+		if word != "" {
+			unique[word] = struct{}{}
+		}
+	}
+	return float64(len(unique)) / float64(len(words))
+}
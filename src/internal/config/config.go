@@ -5,6 +5,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
@@ -18,7 +20,39 @@ type DBConfig struct {
 	DBName     string
 }
 
-var URL = "http://localhost:8000/process_essay"
+type KafkaConfig struct {
+	Brokers     string
+	Topic       string
+	ResultTopic string
+	GroupID     string
+	ClientID    string
+	Acks        string
+}
+
+// CheckerConfig selects the essay checking backend: "kafka", "http" or "stub".
+// Essays without a result after SLA are re-sent up to MaxAttempts times.
+// Checker callbacks are signed with Secret and accepted within SignatureWindow.
+// The outbox relay claims rows for OutboxLease and gives up on a row after
+// OutboxMaxAttempts failed deliveries.
+type CheckerConfig struct {
+	Kind              string
+	URL               string
+	SLA               time.Duration
+	MaxAttempts       int
+	Secret            string
+	SignatureWindow   time.Duration
+	OutboxLease       time.Duration
+	OutboxMaxAttempts int
+}
+
+// AppealConfig holds appeal rules. A claimed appeal that is not resolved within
+// ClaimTimeout goes back to the queue. An essay can be appealed within Window after
+// it was checked, and a user can file MonthlyQuota appeals per calendar month.
+type AppealConfig struct {
+	ClaimTimeout time.Duration
+	Window       time.Duration
+	MonthlyQuota int
+}
 
 func LoadDBConfig() (*DBConfig, error) {
 	err := godotenv.Load()
@@ -37,6 +71,112 @@ func LoadDBConfig() (*DBConfig, error) {
 	return config, nil
 }
 
+func LoadKafkaConfig() *KafkaConfig {
+	return &KafkaConfig{
+		Brokers:     getEnv("KAFKA_BROKERS", "localhost:9092"),
+		Topic:       getEnv("KAFKA_TOPIC", "essay_check_queue"),
+		ResultTopic: getEnv("KAFKA_RESULT_TOPIC", "essay_result_queue"),
+		GroupID:     getEnv("KAFKA_GROUP_ID", "essay_backend"),
+		ClientID:    getEnv("KAFKA_CLIENT_ID", "essay_producer"),
+		Acks:        getEnv("KAFKA_ACKS", "all"),
+	}
+}
+
+func LoadCheckerConfig() *CheckerConfig {
+	return &CheckerConfig{
+		Kind:              getEnv("CHECKER", "kafka"),
+		URL:               getEnv("CHECKER_URL", "http://localhost:8000/process_essay"),
+		SLA:               getDurationEnv("CHECK_SLA", 10*time.Minute),
+		MaxAttempts:       getIntEnv("CHECK_MAX_ATTEMPTS", 3),
+		Secret:            getEnv("CHECKER_SECRET", ""),
+		SignatureWindow:   getDurationEnv("CHECKER_SIGNATURE_WINDOW", 5*time.Minute),
+		OutboxLease:       getDurationEnv("OUTBOX_LEASE", 5*time.Minute),
+		OutboxMaxAttempts: getIntEnv("OUTBOX_MAX_ATTEMPTS", 10),
+	}
+}
+
+// EssayConfig holds essay storage rules. Deleted and archived essays can be restored
+// within Retention, after that they are purged.
+type EssayConfig struct {
+	Retention time.Duration
+}
+
+func LoadEssayConfig() *EssayConfig {
+	return &EssayConfig{
+		Retention: getDurationEnv("ESSAY_RETENTION", 30*24*time.Hour),
+	}
+}
+
+// ExamConfig holds the time limit of exam sessions.
+type ExamConfig struct {
+	Duration time.Duration
+}
+
+func LoadExamConfig() *ExamConfig {
+	return &ExamConfig{
+		Duration: getDurationEnv("EXAM_DURATION", 210*time.Minute),
+	}
+}
+
+// TokenConfig holds token settings. Access tokens are JWTs signed with Key and valid
+// for AccessTTL; refresh tokens are valid for RefreshTTL and used once. Email
+// verification and password reset links are also signed with Key; a new link of the
+// same kind can be requested once per MailCooldown. Without TOKEN_KEY every bearer
+// token is rejected and no links are issued.
+type TokenConfig struct {
+	Key          []byte
+	AccessTTL    time.Duration
+	RefreshTTL   time.Duration
+	VerifyTTL    time.Duration
+	ResetTTL     time.Duration
+	MailCooldown time.Duration
+}
+
+func LoadTokenConfig() *TokenConfig {
+	return &TokenConfig{
+		Key:          []byte(getEnv("TOKEN_KEY", "")),
+		AccessTTL:    getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTTL:   getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		VerifyTTL:    getDurationEnv("EMAIL_VERIFY_TTL", 48*time.Hour),
+		ResetTTL:     getDurationEnv("PASSWORD_RESET_TTL", time.Hour),
+		MailCooldown: getDurationEnv("MAIL_COOLDOWN", 5*time.Minute),
+	}
+}
+
+// MailConfig selects the mailer: "smtp" or "log". The log mailer writes messages to
+// the log, or to .eml files in Dir when it is set. Links in emails lead to AppURL.
+type MailConfig struct {
+	Kind     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Dir      string
+	AppURL   string
+}
+
+func LoadMailConfig() *MailConfig {
+	return &MailConfig{
+		Kind:     getEnv("MAILER", "log"),
+		Host:     getEnv("SMTP_HOST", "localhost"),
+		Port:     getIntEnv("SMTP_PORT", 587),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("MAIL_FROM", "noreply@localhost"),
+		Dir:      getEnv("MAIL_DIR", ""),
+		AppURL:   getEnv("APP_URL", "http://localhost:3000"),
+	}
+}
+
+func LoadAppealConfig() *AppealConfig {
+	return &AppealConfig{
+		ClaimTimeout: getDurationEnv("APPEAL_CLAIM_TIMEOUT", 30*time.Minute),
+		Window:       getDurationEnv("APPEAL_WINDOW", 7*24*time.Hour),
+		MonthlyQuota: getIntEnv("APPEAL_MONTHLY_QUOTA", 3),
+	}
+}
+
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -44,11 +184,49 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-var SessionStore *sessions.CookieStore
+func getIntEnv(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+// SessionStore is the store of user sessions. The app keeps sessions in Postgres;
+// InitSessionStore sets up a cookie store that needs no database.
+var SessionStore sessions.Store
 
 func InitSessionStore() {
-	SessionStore = sessions.NewCookieStore([]byte(getEnv("SECRET_KEY", "SECRET_KEYSECRET_KEY")))
-	SessionStore.Options = &sessions.Options{
+	store := sessions.NewCookieStore(SessionKey())
+	store.Options = SessionOptions()
+	SessionStore = store
+}
+
+// SessionKey is the key that signs session cookies.
+func SessionKey() []byte {
+	return []byte(getEnv("SECRET_KEY", "SECRET_KEYSECRET_KEY"))
+}
+
+func SessionOptions() *sessions.Options {
+	return &sessions.Options{
 		Path:     "/",
 		MaxAge:   7 * 24 * 60 * 60, // неделя
 		HttpOnly: false,
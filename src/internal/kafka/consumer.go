@@ -0,0 +1,197 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"essay/src/internal/config"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// Message is a single record read from a MessageSource.
+type Message struct {
+	Key   []byte
+	Value []byte
+
+	raw *kafka.Message
+}
+
+// MessageSource is where the consumer reads checker results from.
+// ReadMessage returns nil message and nil error when nothing arrived within timeout.
+type MessageSource interface {
+	ReadMessage(timeout time.Duration) (*Message, error)
+	CommitMessage(msg *Message) error
+	Close() error
+}
+
+// ResultSink stores checker results.
+type ResultSink interface {
+	SaveCheckResult(result *models.CheckResult) error
+}
+
+const (
+	pollTimeout     = time.Second
+	maxRetryPause   = 30 * time.Second
+	firstRetryPause = time.Second
+)
+
+// Consumer reads checker results and passes them to a ResultSink.
+type Consumer struct {
+	source MessageSource
+	sink   ResultSink
+
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+func NewConsumer(source MessageSource, sink ResultSink) *Consumer {
+	return &Consumer{
+		source:   source,
+		sink:     sink,
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+}
+
+// Start runs the consumer loop in background.
+func (c *Consumer) Start() {
+	go c.run()
+}
+
+// Stop stops the consumer loop, waits for it to finish and closes the source.
+func (c *Consumer) Stop() {
+	close(c.stopChan)
+	<-c.doneChan
+	if err := c.source.Close(); err != nil {
+		log.Printf("Failed to close result source: %v", err)
+	}
+}
+
+func (c *Consumer) run() {
+	defer close(c.doneChan)
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		default:
+		}
+
+		msg, err := c.source.ReadMessage(pollTimeout)
+		if err != nil {
+			log.Printf("Failed to read check result: %v", err)
+			continue
+		}
+		if msg == nil {
+			continue
+		}
+
+		if !c.process(msg) {
+			return
+		}
+		if err := c.source.CommitMessage(msg); err != nil {
+			log.Printf("Failed to commit check result: %v", err)
+		}
+	}
+}
+
+// process handles message until it is stored or skipped.
+// Returns false if the consumer was stopped before the message was handled.
+func (c *Consumer) process(msg *Message) bool {
+	pause := firstRetryPause
+	for {
+		err := c.handle(msg)
+		switch {
+		case err == nil:
+			return true
+		case errors.Is(err, services.ErrInvalidResult):
+			log.Printf("Skipping check result %s: %v", msg.Key, err)
+			return true
+		case errors.Is(err, services.ErrResultExists):
+			log.Printf("Skipping duplicate check result: %s", msg.Key)
+			return true
+		case errors.Is(err, services.ErrWrongStatus):
+			log.Printf("Skipping check result for essay not waiting for it: %s", msg.Key)
+			return true
+		}
+
+		log.Printf("Failed to save check result, retrying in %s: %v", pause, err)
+		select {
+		case <-c.stopChan:
+			return false
+		case <-time.After(pause):
+		}
+		pause = min(pause*2, maxRetryPause)
+	}
+}
+
+func (c *Consumer) handle(msg *Message) error {
+	var result models.CheckResult
+	if err := json.Unmarshal(msg.Value, &result); err != nil {
+		return fmt.Errorf("%w: %v", services.ErrInvalidResult, err)
+	}
+	if result.EssayID == 0 {
+		return fmt.Errorf("%w: essay_id is required", services.ErrInvalidResult)
+	}
+	if result.AttemptID == "" {
+		return fmt.Errorf("%w: attempt_id is required", services.ErrInvalidResult)
+	}
+
+	if err := c.sink.SaveCheckResult(&result); err != nil {
+		return err
+	}
+	log.Printf("Check result saved for essay %d, attempt %s", result.EssayID, result.AttemptID)
+	return nil
+}
+
+type kafkaSource struct {
+	consumer *kafka.Consumer
+}
+
+// NewKafkaSource subscribes to the result topic.
+func NewKafkaSource(cfg *config.KafkaConfig) (MessageSource, error) {
+	c, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":  cfg.Brokers,
+		"client.id":          cfg.ClientID,
+		"group.id":           cfg.GroupID,
+		"auto.offset.reset":  "earliest",
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+
+	if err := c.SubscribeTopics([]string{cfg.ResultTopic}, nil); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", cfg.ResultTopic, err)
+	}
+
+	return &kafkaSource{consumer: c}, nil
+}
+
+func (s *kafkaSource) ReadMessage(timeout time.Duration) (*Message, error) {
+	m, err := s.consumer.ReadMessage(timeout)
+	if err != nil {
+		var kafkaErr kafka.Error
+		if errors.As(err, &kafkaErr) && kafkaErr.Code() == kafka.ErrTimedOut {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &Message{Key: m.Key, Value: m.Value, raw: m}, nil
+}
+
+func (s *kafkaSource) CommitMessage(msg *Message) error {
+	_, err := s.consumer.CommitMessage(msg.raw)
+	return err
+}
+
+func (s *kafkaSource) Close() error {
+	return s.consumer.Close()
+}
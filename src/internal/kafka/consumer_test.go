@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySource serves messages from a slice and records commits.
+type memorySource struct {
+	mu        sync.Mutex
+	messages  []*Message
+	committed []*Message
+	closed    bool
+}
+
+func (s *memorySource) ReadMessage(timeout time.Duration) (*Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.messages) == 0 {
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	return msg, nil
+}
+
+func (s *memorySource) CommitMessage(msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = append(s.committed, msg)
+	return nil
+}
+
+func (s *memorySource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *memorySource) commits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.committed)
+}
+
+// memorySink keeps results keyed by essay and attempt the way the result table does.
+type memorySink struct {
+	mu      sync.Mutex
+	results map[string]models.CheckResult
+}
+
+func (s *memorySink) SaveCheckResult(result *models.CheckResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := result.AttemptID
+	if _, ok := s.results[key]; ok {
+		return services.ErrResultExists
+	}
+	s.results[key] = *result
+	return nil
+}
+
+func runConsumer(t *testing.T, source *memorySource, sink ResultSink, commits int) {
+	consumer := NewConsumer(source, sink)
+	consumer.Start()
+	assert.Eventually(t, func() bool { return source.commits() == commits }, time.Second, 5*time.Millisecond)
+	consumer.Stop()
+	assert.True(t, source.closed)
+}
+
+func TestConsumer_SavesResults(t *testing.T) {
+	source := &memorySource{messages: []*Message{
+		{Key: []byte("1"), Value: []byte(`{"essay_id": 1, "attempt_id": "a1", "llm_response": {"K1_score": 1}}`)},
+	}}
+	sink := &memorySink{results: map[string]models.CheckResult{}}
+
+	runConsumer(t, source, sink, 1)
+
+	assert.Equal(t, uint64(1), sink.results["a1"].EssayID)
+	k1, _ := sink.results["a1"].LLMResponse.Criterion("K1")
+	assert.Equal(t, 1, k1.Score)
+}
+
+func TestConsumer_SkipsRedeliveredResult(t *testing.T) {
+	value := []byte(`{"essay_id": 1, "attempt_id": "a1", "llm_response": {"K1_score": 1}}`)
+	source := &memorySource{messages: []*Message{
+		{Key: []byte("1"), Value: value},
+		{Key: []byte("1"), Value: value},
+	}}
+	sink := &memorySink{results: map[string]models.CheckResult{}}
+
+	runConsumer(t, source, sink, 2)
+
+	assert.Len(t, sink.results, 1)
+}
+
+func TestConsumer_SkipsInvalidMessages(t *testing.T) {
+	source := &memorySource{messages: []*Message{
+		{Value: []byte(`not json`)},
+		{Value: []byte(`{"attempt_id": "a1"}`)},
+		{Value: []byte(`{"essay_id": 1}`)},
+	}}
+	sink := &memorySink{results: map[string]models.CheckResult{}}
+
+	runConsumer(t, source, sink, 3)
+
+	assert.Empty(t, sink.results)
+}
@@ -4,33 +4,64 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 
+	"essay/src/internal/config"
 	"essay/src/internal/models"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
 
-// ProduceEssay sends essay in Kafka queue
-func ProduceEssay(broker, topic string, essay models.Essay) error {
+// EssayProducer sends essays for checking.
+type EssayProducer interface {
+	ProduceEssay(request models.EssayRequest) error
+	Close()
+}
+
+// Producer is a long-lived Kafka producer bound to one topic.
+type Producer struct {
+	producer *kafka.Producer
+	topic    string
+}
+
+// NewProducer creates a producer for the configured topic.
+func NewProducer(cfg *config.KafkaConfig) (*Producer, error) {
 	p, err := kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": broker,
-		"acks":              "all",
+		"bootstrap.servers": cfg.Brokers,
+		"client.id":         cfg.ClientID,
+		"acks":              cfg.Acks,
+		// не держим пользователя дольше, чем нужно, если брокер недоступен
+		"message.timeout.ms": 10000,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create producer: %w", err)
+		return nil, fmt.Errorf("failed to create producer: %w", err)
 	}
-	defer p.Close()
 
-	essayJSON, err := json.Marshal(essay)
+	// события без канала доставки (ошибки соединения и т.п.)
+	go func() {
+		for e := range p.Events() {
+			if err, ok := e.(kafka.Error); ok {
+				log.Printf("Kafka producer error: %v", err)
+			}
+		}
+	}()
+
+	return &Producer{producer: p, topic: cfg.Topic}, nil
+}
+
+// ProduceEssay sends essay in Kafka queue and waits for delivery.
+func (p *Producer) ProduceEssay(request models.EssayRequest) error {
+	essayJSON, err := json.Marshal(request)
 	if err != nil {
 		return fmt.Errorf("failed to marshal essay: %w", err)
 	}
 
-	deliveryChan := make(chan kafka.Event)
+	deliveryChan := make(chan kafka.Event, 1)
 
-	log.Printf("Producing message to topic %s: %s", topic, string(essayJSON))
-	err = p.Produce(&kafka.Message{
-		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+	log.Printf("Producing message to topic %s for essay %d", p.topic, request.EssayID)
+	err = p.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &p.topic, Partition: kafka.PartitionAny},
+		Key:            []byte(strconv.FormatUint(request.EssayID, 10)),
 		Value:          essayJSON,
 	}, deliveryChan)
 	if err != nil {
@@ -38,7 +69,10 @@ func ProduceEssay(broker, topic string, essay models.Essay) error {
 	}
 
 	e := <-deliveryChan
-	m := e.(*kafka.Message)
+	m, ok := e.(*kafka.Message)
+	if !ok {
+		return fmt.Errorf("unexpected delivery event: %v", e)
+	}
 	if m.TopicPartition.Error != nil {
 		return fmt.Errorf("delivery failed: %w", m.TopicPartition.Error)
 	}
@@ -46,3 +80,9 @@ func ProduceEssay(broker, topic string, essay models.Essay) error {
 	log.Printf("Message delivered to topic %s [%d] at offset %d\n", *m.TopicPartition.Topic, m.TopicPartition.Partition, m.TopicPartition.Offset)
 	return nil
 }
+
+// Close flushes outstanding messages and closes the producer.
+func (p *Producer) Close() {
+	p.producer.Flush(5000)
+	p.producer.Close()
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LogMailer is the mailer for local development: it writes messages to dir as .eml
+// files, or to the log when dir is empty. Nothing is sent.
+type LogMailer struct {
+	from string
+	dir  string
+	now  func() time.Time
+}
+
+func NewLogMailer(from, dir string) *LogMailer {
+	return &LogMailer{from: from, dir: dir, now: time.Now}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	if m.dir == "" {
+		log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+	now := m.now()
+	// имя файла: время отправки и адрес, чтобы письма сортировались по времени
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102-150405.000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg, now), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s written to %s", msg.To, path)
+	return nil
+}
@@ -0,0 +1,63 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+
+	"essay/src/internal/config"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email to users.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New creates the mailer selected by cfg.Kind.
+func New(cfg *config.MailConfig) (Mailer, error) {
+	switch cfg.Kind {
+	case "smtp":
+		return NewSMTPMailer(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From), nil
+	case "log":
+		return NewLogMailer(cfg.From, cfg.Dir), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.Kind)
+	}
+}
+
+// format returns the message in RFC 5322 format. The subject and body are encoded,
+// so they may contain Cyrillic.
+func format(from string, msg Message, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	// длинная тема кодируется несколькими словами: каждое на своей строке,
+	// чтобы строки заголовка не превышали 78 символов
+	subject := mime.QEncoding.Encode("utf-8", msg.Subject)
+	if subject != msg.Subject {
+		subject = "\r\n " + strings.ReplaceAll(subject, "?= =?", "?=\r\n =?")
+	}
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes()
+}
@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"essay/src/internal/config"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := strings.Repeat("Здравствуйте! ", 20)
+	raw := format("noreply@example.com", Message{To: "user1@example.com", Subject: "Восстановление пароля", Body: body}, date)
+
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "noreply@example.com", msg.Header.Get("From"))
+	assert.Equal(t, "user1@example.com", msg.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Восстановление пароля", subject)
+	sent, err := msg.Header.Date()
+	assert.NoError(t, err)
+	assert.True(t, date.Equal(sent))
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.NewReplacer("\r", "", "\n", "").Replace(readAll(t, msg)))
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+}
+
+func TestLogMailer_WritesFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewLogMailer("noreply@example.com", dir)
+	m.now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	assert.NoError(t, m.Send(Message{To: "user1@example.com", Subject: "Test", Body: "Hello"}))
+
+	raw, err := os.ReadFile(filepath.Join(dir, "20240301-120000.000000-user1_at_example.com.eml"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, string(raw), "To: user1@example.com\r\n")
+}
+
+func TestNew_UnknownKind(t *testing.T) {
+	_, err := New(&config.MailConfig{Kind: "pigeon"})
+	assert.Error(t, err)
+}
+
+func readAll(t *testing.T, msg *mail.Message) string {
+	var b strings.Builder
+	_, err := io.Copy(&b, msg.Body)
+	assert.NoError(t, err)
+	return b.String()
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+)
+
+// Role is what a caller must be to use a route.
+type Role int
+
+const (
+	RoleAnonymous Role = iota
+	RoleUser
+	RoleModerator
+	RoleAdmin
+	RoleService // сервис проверки, запрос подписан CHECKER_SECRET
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleAnonymous:
+		return "anonymous"
+	case RoleUser:
+		return "user"
+	case RoleModerator:
+		return "moderator"
+	case RoleAdmin:
+		return "admin"
+	case RoleService:
+		return "service"
+	}
+	return "unknown"
+}
+
+// Principal is the caller of a request. The zero value is an anonymous caller.
+type Principal struct {
+	UserID      uint64
+	IsModerator bool
+	IsAdmin     bool
+	Service     bool
+	SessionID   string // токен сессии, из которой получен пользователь; пуст для bearer-токена
+}
+
+func (p *Principal) Authenticated() bool {
+	return p.UserID != 0
+}
+
+// Has tells whether the principal may act in the role. Admins are also moderators,
+// moderators are also users.
+func (p *Principal) Has(role Role) bool {
+	switch role {
+	case RoleAnonymous:
+		return true
+	case RoleUser:
+		return p.Authenticated()
+	case RoleModerator:
+		return p.Authenticated() && (p.IsModerator || p.IsAdmin)
+	case RoleAdmin:
+		return p.Authenticated() && p.IsAdmin
+	case RoleService:
+		return p.Service
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the principal of the request context, anonymous if there is none.
+func PrincipalFrom(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return &Principal{}
+}
+
+// Authenticate resolves the caller once per request and puts the principal into the
+// request context. A request with an "Authorization: Bearer" header is authenticated
+// by the access token only, others by the session cookie. An invalid or expired token
+// is rejected with 401 so the client knows to refresh it.
+func Authenticate(store sessions.Store, tokenKey []byte) func(next http.Handler) http.Handler {
+	if len(tokenKey) == 0 {
+		log.Println("Token key is empty, every bearer token will be rejected")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := &Principal{}
+			if token, ok := bearerToken(r); ok {
+				claims, err := ParseToken(tokenKey, token, time.Now())
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				p.UserID = claims.UserID
+				p.IsModerator = claims.IsModerator
+				p.IsAdmin = claims.IsAdmin
+			} else if session, err := store.Get(r, "session"); err == nil {
+				if userID, ok := session.Values["user_id"].(uint64); ok {
+					p.UserID = userID
+					p.IsModerator, _ = session.Values["is_moderator"].(bool)
+					p.IsAdmin, _ = session.Values["is_admin"].(bool)
+					p.SessionID = session.ID
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+// Policy is the role required by a route, possibly different per HTTP method.
+type Policy struct {
+	Role    Role
+	Methods map[string]Role
+}
+
+// Only requires role for every method.
+func Only(role Role) Policy {
+	return Policy{Role: role}
+}
+
+// ReadWrite requires read for GET and HEAD and write for other methods.
+func ReadWrite(read, write Role) Policy {
+	return Policy{Role: write, Methods: map[string]Role{http.MethodGet: read, http.MethodHead: read}}
+}
+
+// For returns the role required for method.
+func (p Policy) For(method string) Role {
+	if role, ok := p.Methods[method]; ok {
+		return role
+	}
+	return p.Role
+}
+
+// Require rejects requests whose principal lacks the role of the policy: 401 for
+// anonymous callers, 403 for users without enough rights. CORS preflight requests
+// pass through.
+func Require(policy Policy, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role := policy.For(r.Method)
+		p := PrincipalFrom(r.Context())
+		if r.Method == http.MethodOptions || p.Has(role) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if role == RoleService || !p.Authenticated() {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	})
+}
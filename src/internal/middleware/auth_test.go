@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequire(t *testing.T) {
+	handler := Require(ReadWrite(RoleAnonymous, RoleModerator), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	anonymous := &Principal{}
+	user := &Principal{UserID: 1}
+	moderator := &Principal{UserID: 2, IsModerator: true}
+	admin := &Principal{UserID: 3, IsAdmin: true}
+
+	tests := []struct {
+		name      string
+		method    string
+		principal *Principal
+		code      int
+	}{
+		{"anonymous reads", http.MethodGet, anonymous, http.StatusOK},
+		{"anonymous writes", http.MethodPost, anonymous, http.StatusUnauthorized},
+		{"user writes", http.MethodPost, user, http.StatusForbidden},
+		{"moderator writes", http.MethodPost, moderator, http.StatusOK},
+		{"admin is moderator", http.MethodPost, admin, http.StatusOK},
+		{"preflight", http.MethodOptions, anonymous, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/rubrics/ege/versions", nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req.WithContext(WithPrincipal(req.Context(), tt.principal)))
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestRequire_Service(t *testing.T) {
+	handler := Require(Only(RoleService), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// даже администратор не может выдать себя за сервис проверки
+	req := httptest.NewRequest(http.MethodPost, "/result/1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(WithPrincipal(req.Context(), &Principal{UserID: 3, IsAdmin: true})))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/result/1", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req.WithContext(WithPrincipal(req.Context(), &Principal{Service: true})))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := sessions.NewCookieStore([]byte("secret"))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	rec := httptest.NewRecorder()
+	session, _ := store.New(req, "session")
+	session.Values["user_id"] = uint64(7)
+	session.Values["is_moderator"] = true
+	session.Save(req, rec)
+
+	var principal *Principal
+	handler := Authenticate(store, []byte("token key"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFrom(r.Context())
+	}))
+
+	req = httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, &Principal{UserID: 7, IsModerator: true}, principal)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/info", nil))
+	assert.False(t, principal.Authenticated())
+}
+
+func TestAuthenticate_Bearer(t *testing.T) {
+	key := []byte("token key")
+	token, _ := SignToken(key, TokenClaims{UserID: 7, IsAdmin: true, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+
+	var principal *Principal
+	handler := Authenticate(sessions.NewCookieStore([]byte("secret")), key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = PrincipalFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, &Principal{UserID: 7, IsAdmin: true}, principal)
+
+	// неверный токен не подменяется анонимным доступом
+	principal = nil
+	req = httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, principal)
+}
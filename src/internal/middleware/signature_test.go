@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func signedRequest(secret string, signedAt time.Time, body string) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, "/result/1", strings.NewReader(body))
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, http.MethodPost, "/result/1", []byte(body)))
+	return req
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := NewSignatureVerifier("secret", 5*time.Minute)
+	verifier.now = func() time.Time { return now }
+
+	var received string
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+	}))
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		code    int
+	}{
+		{"valid", signedRequest("secret", now, `{"a":1}`), http.StatusOK},
+		{"wrong secret", signedRequest("other", now, `{"a":2}`), http.StatusUnauthorized},
+		{"too old", signedRequest("secret", now.Add(-6*time.Minute), `{"a":3}`), http.StatusUnauthorized},
+		{"from future", signedRequest("secret", now.Add(6*time.Minute), `{"a":4}`), http.StatusUnauthorized},
+		{"unsigned", httptest.NewRequest(http.MethodPost, "/result/1", nil), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.request)
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+	assert.Equal(t, `{"a":1}`, received)
+}
+
+func TestSignatureVerifier_RejectsReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := NewSignatureVerifier("secret", 5*time.Minute)
+	verifier.now = func() time.Time { return now }
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, signedRequest("secret", now, `{}`))
+	replay := httptest.NewRecorder()
+	handler.ServeHTTP(replay, signedRequest("secret", now, `{}`))
+
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusUnauthorized, replay.Code)
+}
+
+func TestSignatureVerifier_EmptySecret(t *testing.T) {
+	verifier := NewSignatureVerifier("", 5*time.Minute)
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signedRequest("", time.Now(), `{}`))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// tokenHeader is the only JOSE header we issue and accept: HS256 JWT.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenClaims are the claims of an access token. Roles are copied from the user when
+// the token is issued, so a role change takes effect with the next token.
+type TokenClaims struct {
+	UserID      uint64 `json:"sub,string"`
+	IsModerator bool   `json:"mod,omitempty"`
+	IsAdmin     bool   `json:"adm,omitempty"`
+	IssuedAt    int64  `json:"iat"`
+	ExpiresAt   int64  `json:"exp"`
+}
+
+// SignToken returns the claims as a JWT signed with HMAC-SHA256.
+func SignToken(key []byte, claims TokenClaims) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("token key is empty")
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + tokenSignature(key, unsigned), nil
+}
+
+// ParseToken checks the signature and expiry of a JWT and returns its claims.
+func ParseToken(key []byte, token string, now time.Time) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(key) == 0 || len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	// заголовок сравниваем целиком: алгоритм выбирает сервер, а не токен
+	if parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(tokenSignature(key, parts[0]+"."+parts[1]))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID == 0 || now.Unix() >= claims.ExpiresAt {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+func tokenSignature(key []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
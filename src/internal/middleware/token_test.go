@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToken(t *testing.T) {
+	key := []byte("token key")
+	now := time.Unix(1700000000, 0)
+	claims := TokenClaims{UserID: 7, IsModerator: true, IssuedAt: now.Unix(), ExpiresAt: now.Add(15 * time.Minute).Unix()}
+	token, err := SignToken(key, claims)
+	assert.NoError(t, err)
+
+	parsed, err := ParseToken(key, token, now)
+	assert.NoError(t, err)
+	assert.Equal(t, &claims, parsed)
+
+	parts := strings.Split(token, ".")
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."
+	// подпись пустым ключом не должна приниматься никогда
+	noKey := parts[0] + "." + parts[1] + "." + tokenSignature(nil, parts[0]+"."+parts[1])
+	forged := strings.Replace(token, parts[1], base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","adm":true,"exp":1800000000}`)), 1)
+
+	tests := []struct {
+		name  string
+		key   string
+		token string
+		now   time.Time
+	}{
+		{"wrong key", "other key", token, now},
+		{"expired", "token key", token, now.Add(15 * time.Minute)},
+		{"forged claims", "token key", forged, now},
+		{"alg none", "token key", unsigned, now},
+		{"garbage", "token key", "abc", now},
+		{"empty key", "", noKey, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseToken([]byte(tt.key), tt.token, tt.now)
+			assert.Equal(t, ErrInvalidToken, err)
+		})
+	}
+}
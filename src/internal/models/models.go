@@ -8,24 +8,90 @@ type User struct {
 	Nickname    string `json:"nickname"`
 	Password    string `json:"password"`
 	IsModerator bool   `json:"is_moderator"`
+	IsAdmin     bool   `json:"is_admin"`
 	CountChecks int    `json:"count_checks"`
 }
 
+// TokenPair is the response of POST /auth/token.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // секунды
+	RefreshToken string `json:"refresh_token"`
+}
+
+// UserSession is a signed-in device of the user.
+type UserSession struct {
+	ID         uint64    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Current    bool      `json:"current"`
+}
+
 type Essay struct {
-	ID          uint64    `json:"id"`
-	EssayText   string    `json:"essay_text"`
-	CompletedAt time.Time `json:"completed_at"`
-	Status      string    `json:"status"`
-	IsPublished bool      `json:"is_published"`
-	UserID      uint64    `json:"user_id"`
-	VariantID   uint64    `json:"variant_id"`
+	ID          uint64     `json:"id"`
+	EssayText   string     `json:"essay_text"`
+	CompletedAt time.Time  `json:"completed_at"`
+	Status      string     `json:"status"`
+	IsPublished bool       `json:"is_published"`
+	UserID      uint64     `json:"user_id"`
+	VariantID   uint64     `json:"variant_id"`
+	Version     int        `json:"version"`
+	RemovedAt   *time.Time `json:"removed_at,omitempty"` // когда сочинение удалено или архивировано
+}
+
+// EssayRevision is one attempt of a revision chain with its latest result.
+type EssayRevision struct {
+	ID            uint64              `json:"id"`
+	ParentEssayID *uint64             `json:"parent_essay_id"`
+	Status        string              `json:"status"`
+	CompletedAt   time.Time           `json:"completed_at"`
+	Score         *int                `json:"score"`
+	ScoreDelta    *int                `json:"score_delta,omitempty"`
+	Criteria      []RevisionCriterion `json:"criteria"`
+}
+
+// EssayTextRevision is a saved version of an essay text.
+type EssayTextRevision struct {
+	ID        uint64    `json:"id"`
+	EssayID   uint64    `json:"essay_id"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TextDiff lists word level changes between two essay text revisions.
+type TextDiff struct {
+	From    uint64       `json:"from"`
+	To      uint64       `json:"to"`
+	Changes []TextChange `json:"changes"`
+}
+
+// TextChange is an insertion or a deletion. Offset and Length count characters: for a
+// deletion in the old text, for an insertion in the new one.
+type TextChange struct {
+	Op     string `json:"op"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Text   string `json:"text"`
+}
+
+// RevisionCriterion is a criterion score of a revision and its change since the parent.
+type RevisionCriterion struct {
+	CriteriaID uint64 `json:"criteria_id"`
+	Code       string `json:"code"`
+	Title      string `json:"title"`
+	Score      int    `json:"score"`
+	Delta      *int   `json:"delta,omitempty"`
 }
 
 type Variant struct {
-	ID             uint64 `json:"id"`
-	VariantTitle   string `json:"variant_title"`
-	VariantText    string `json:"variant_text"`
-	AuthorPosition string `json:"author_position"`
+	ID              uint64 `json:"id"`
+	VariantTitle    string `json:"variant_title"`
+	VariantText     string `json:"variant_text"`
+	AuthorPosition  string `json:"author_position"`
+	RubricVersionID uint64 `json:"rubric_version_id,omitempty"`
 }
 
 type Comment struct {
@@ -50,10 +116,26 @@ type Result struct {
 
 type Criteria struct {
 	ID       uint64 `json:"id"`
+	Code     string `json:"code"`
 	Title    string `json:"title"`
 	MaxScore int    `json:"max_score"`
 }
 
+type Rubric struct {
+	ID    uint64 `json:"id"`
+	Code  string `json:"code"`
+	Title string `json:"title"`
+}
+
+// RubricVersion is a published, immutable set of criteria of a rubric.
+type RubricVersion struct {
+	ID          uint64     `json:"id"`
+	RubricCode  string     `json:"rubric_code"`
+	Version     int        `json:"version"`
+	PublishedAt time.Time  `json:"published_at"`
+	Criteria    []Criteria `json:"criteria"`
+}
+
 type ResultCriteria struct {
 	ResultID    uint64 `json:"result_id"`
 	CriteriaID  uint64 `json:"criteria_id"`
@@ -62,13 +144,15 @@ type ResultCriteria struct {
 }
 
 type EssayCard struct {
-	ID             uint64 `json:"id"`
-	VariantID      uint64 `json:"variant_id"`
-	VariantTitle   string `json:"variant_title"`
-	AuthorNickname string `json:"author_nickname"`
-	Likes          int    `json:"likes"`
-	Score          int    `json:"score"`
-	Status         string `json:"status"`
+	ID             uint64     `json:"id"`
+	VariantID      uint64     `json:"variant_id"`
+	VariantTitle   string     `json:"variant_title"`
+	AuthorNickname string     `json:"author_nickname"`
+	Likes          int        `json:"likes"`
+	Score          int        `json:"score"`
+	Status         string     `json:"status"`
+	AppealID       uint64     `json:"appeal_id,omitempty"`
+	RemovedAt      *time.Time `json:"removed_at,omitempty"`
 }
 
 type DetailedEssay struct {
@@ -79,12 +163,17 @@ type DetailedEssay struct {
 	EssayText      string                 `json:"essay_text"`
 	CompletedAt    time.Time              `json:"completed_at"`
 	Status         string                 `json:"status"`
+	Version        int                    `json:"version"`
 	IsPublished    bool                   `json:"is_published"`
+	RemovedAt      *time.Time             `json:"removed_at,omitempty"`
+	Exam           *ExamSession           `json:"exam,omitempty"`
 	AuthorID       uint64                 `json:"author_id"`
 	AuthorNickname string                 `json:"author_nickname"`
 	Likes          int                    `json:"likes"`
 	Comments       []DetailedEssayComment `json:"comments"`
 	Results        []DetailedResult       `json:"results"`
+	CheckAttempts  []CheckAttempt         `json:"check_attempts,omitempty"`
+	Appeal         *AppealReview          `json:"appeal,omitempty"`
 }
 
 type AppealEssay struct {
@@ -104,29 +193,22 @@ type DetailedEssayComment struct {
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+// DetailedResult is a checked result with one entry per grading criterion.
+// See result.go for the JSON rendering with legacy K1_score… keys.
 type DetailedResult struct {
-	K1_score        int     `json:"K1_score"`
-	K2_score        int     `json:"K2_score"`
-	K3_score        int     `json:"K3_score"`
-	K4_score        int     `json:"K4_score"`
-	K5_score        int     `json:"K5_score"`
-	K6_score        int     `json:"K6_score"`
-	K7_score        int     `json:"K7_score"`
-	K8_score        int     `json:"K8_score"`
-	K9_score        int     `json:"K9_score"`
-	K10_score       int     `json:"K10_score"`
-	K1_explanation  string  `json:"K1_explanation"`
-	K2_explanation  string  `json:"K2_explanation"`
-	K3_explanation  string  `json:"K3_explanation"`
-	K4_explanation  string  `json:"K4_explanation"`
-	K5_explanation  string  `json:"K5_explanation"`
-	K6_explanation  string  `json:"K6_explanation"`
-	K7_explanation  string  `json:"K7_explanation"`
-	K8_explanation  string  `json:"K8_explanation"`
-	K9_explanation  string  `json:"K9_explanation"`
-	K10_explanation string  `json:"K10_explanation"`
-	Score           *int    `json:"score,omitempty"`
-	AppealText      *string `json:"appeal_text,omitempty"`
+	Criteria        []CriterionScore `json:"criteria"`
+	Score           *int             `json:"score,omitempty"`
+	AppealText      *string          `json:"appeal_text,omitempty"`
+	RubricVersionID uint64           `json:"rubric_version_id,omitempty"`
+}
+
+type CriterionScore struct {
+	CriteriaID  uint64 `json:"criteria_id"`
+	Code        string `json:"code,omitempty"`
+	Title       string `json:"title,omitempty"`
+	MaxScore    int    `json:"max_score,omitempty"`
+	Score       int    `json:"score"`
+	Explanation string `json:"explanation"`
 }
 
 type UserInfo struct {
@@ -134,20 +216,138 @@ type UserInfo struct {
 	Mail                 string  `json:"mail"`
 	Nickname             string  `json:"nickname"`
 	IsModerator          bool    `json:"is_moderator"`
+	EmailVerified        bool    `json:"email_verified"`
 	CountChecks          int     `json:"count_checks"`
 	CountEssays          int     `json:"count_essays"`
 	CountPublishedEssays int     `json:"count_published_essays"`
 	AverageResult        float64 `json:"average_result"`
+	RemainingAppeals     *int    `json:"remaining_appeals,omitempty"`
 }
 
 type EssayRequest struct {
 	EssayID        uint64 `json:"essay_id"`
+	AttemptID      string `json:"attempt_id"`
 	EssayText      string `json:"essay_text"`
 	VariantText    string `json:"variant_text"`
 	AuthorPosition string `json:"author_position"`
 }
 
+type CheckResult struct {
+	EssayID     uint64         `json:"essay_id"`
+	AttemptID   string         `json:"attempt_id"`
+	LLMResponse DetailedResult `json:"llm_response"`
+}
+
+// Appeal is a student's request to re-grade a checked essay.
+// Status goes filed -> claimed -> resolved or rejected.
+type Appeal struct {
+	ID                uint64            `json:"id"`
+	EssayID           uint64            `json:"essay_id"`
+	UserID            uint64            `json:"user_id"`
+	Status            string            `json:"status"`
+	AppealText        string            `json:"appeal_text"`
+	Criteria          []AppealCriterion `json:"criteria"`
+	ModeratorID       uint64            `json:"moderator_id,omitempty"`
+	ClaimedAt         *time.Time        `json:"claimed_at,omitempty"`
+	ResolutionComment string            `json:"resolution_comment,omitempty"`
+	ResultID          uint64            `json:"result_id,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	ResolvedAt        *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// AppealCriterion is the student's reason and the moderator's decision on one criterion.
+type AppealCriterion struct {
+	CriteriaID      uint64 `json:"criteria_id"`
+	Code            string `json:"code,omitempty"`
+	Reason          string `json:"reason"`
+	DecisionScore   *int   `json:"decision_score,omitempty"`
+	DecisionComment string `json:"decision_comment,omitempty"`
+}
+
+// AppealReview shows the outcome of an appeal criterion by criterion.
+type AppealReview struct {
+	ID                uint64                  `json:"id"`
+	Status            string                  `json:"status"`
+	AppealText        string                  `json:"appeal_text"`
+	ResolutionComment string                  `json:"resolution_comment,omitempty"`
+	ResolvedAt        *time.Time              `json:"resolved_at,omitempty"`
+	Criteria          []AppealCriterionReview `json:"criteria"`
+}
+
+// AppealCriterionReview puts the original score next to the revised one. RevisedScore
+// is empty until the appeal is resolved or when it was rejected.
+type AppealCriterionReview struct {
+	CriteriaID    uint64 `json:"criteria_id"`
+	Code          string `json:"code"`
+	Title         string `json:"title"`
+	MaxScore      int    `json:"max_score"`
+	OriginalScore int    `json:"original_score"`
+	RevisedScore  *int   `json:"revised_score"`
+	Appealed      bool   `json:"appealed"`
+	Reason        string `json:"reason,omitempty"`
+	Explanation   string `json:"explanation,omitempty"`
+}
+
+// Actor is who changed an essay: a user, a moderator, the checker or the system.
+type Actor struct {
+	Kind   string `json:"kind"`
+	UserID uint64 `json:"user_id,omitempty"`
+}
+
+type EssayStatusChange struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Actor     Actor     `json:"actor"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CheckAttempt struct {
+	AttemptNumber int        `json:"attempt_number"`
+	Status        string     `json:"status"`
+	CreatedAt     time.Time  `json:"created_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
 type ResultDate struct {
 	CompletedAt time.Time `json:"completed_at"`
 	Score       int       `json:"score"`
+	IsExam      bool      `json:"is_exam"`
+}
+
+// Precheck is the result of checking an essay before it is sent to the checker.
+type Precheck struct {
+	Passed        bool            `json:"passed"`
+	Words         int             `json:"words"`
+	OriginalWords int             `json:"original_words"`
+	Paragraphs    int             `json:"paragraphs"`
+	CopiedShare   float64         `json:"copied_share"`
+	CyrillicShare float64         `json:"cyrillic_share"`
+	Errors        []PrecheckIssue `json:"errors,omitempty"`
+	Warnings      []PrecheckIssue `json:"warnings,omitempty"`
+}
+
+type PrecheckIssue struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ExamSession is a timed attempt written under exam conditions.
+type ExamSession struct {
+	ID         uint64         `json:"id"`
+	UserID     uint64         `json:"user_id"`
+	EssayID    uint64         `json:"essay_id"`
+	VariantID  uint64         `json:"variant_id"`
+	Status     string         `json:"status"`
+	StartedAt  time.Time      `json:"started_at"`
+	DeadlineAt time.Time      `json:"deadline_at"`
+	EndedAt    *time.Time     `json:"ended_at,omitempty"`
+	Snapshots  []ExamSnapshot `json:"snapshots,omitempty"`
+}
+
+// ExamSnapshot is the essay text autosaved during an exam session.
+type ExamSnapshot struct {
+	Version   int       `json:"version"`
+	EssayText string    `json:"essay_text"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// legacyKey matches the flat K1_score / K1_explanation keys used before
+// results became a list of criteria.
+var legacyKey = regexp.MustCompile(`^(K(\d+))_(score|explanation)$`)
+
+// MarshalJSON renders the criteria list and, for criteria with a K<n> code,
+// the legacy K<n>_score and K<n>_explanation keys.
+func (r DetailedResult) MarshalJSON() ([]byte, error) {
+	criteria := r.Criteria
+	if criteria == nil {
+		criteria = []CriterionScore{}
+	}
+
+	out := map[string]any{"criteria": criteria}
+	if r.Score != nil {
+		out["score"] = *r.Score
+	}
+	if r.AppealText != nil {
+		out["appeal_text"] = *r.AppealText
+	}
+	if r.RubricVersionID != 0 {
+		out["rubric_version_id"] = r.RubricVersionID
+	}
+	for _, c := range criteria {
+		if legacyKey.MatchString(c.Code + "_score") {
+			out[c.Code+"_score"] = c.Score
+			out[c.Code+"_explanation"] = c.Explanation
+		}
+	}
+
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON accepts either the criteria list or the legacy flat keys.
+// Legacy keys become criteria identified by code only.
+func (r *DetailedResult) UnmarshalJSON(data []byte) error {
+	type plain DetailedResult
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	*r = DetailedResult(p)
+	if len(r.Criteria) > 0 {
+		return nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	byCode := map[string]*CriterionScore{}
+	order := map[string]int{}
+	for key, value := range raw {
+		m := legacyKey.FindStringSubmatch(key)
+		if m == nil {
+			continue
+		}
+		code := m[1]
+		c, ok := byCode[code]
+		if !ok {
+			c = &CriterionScore{Code: code}
+			byCode[code] = c
+			order[code], _ = strconv.Atoi(m[2])
+		}
+
+		var err error
+		if m[3] == "score" {
+			err = json.Unmarshal(value, &c.Score)
+		} else {
+			err = json.Unmarshal(value, &c.Explanation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range byCode {
+		r.Criteria = append(r.Criteria, *c)
+	}
+	sort.Slice(r.Criteria, func(i, j int) bool {
+		return order[r.Criteria[i].Code] < order[r.Criteria[j].Code]
+	})
+
+	return nil
+}
+
+// Criterion returns the entry with the given code.
+func (r DetailedResult) Criterion(code string) (CriterionScore, bool) {
+	for _, c := range r.Criteria {
+		if c.Code == code {
+			return c, true
+		}
+	}
+	return CriterionScore{}, false
+}
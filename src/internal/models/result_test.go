@@ -0,0 +1,50 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetailedResult_UnmarshalLegacyKeys(t *testing.T) {
+	var result DetailedResult
+	err := json.Unmarshal([]byte(`{"K10_score": 2, "K1_score": 1, "K1_explanation": "ok", "K2_score": 3}`), &result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []CriterionScore{
+		{Code: "K1", Score: 1, Explanation: "ok"},
+		{Code: "K2", Score: 3},
+		{Code: "K10", Score: 2},
+	}, result.Criteria)
+}
+
+func TestDetailedResult_UnmarshalCriteria(t *testing.T) {
+	var result DetailedResult
+	err := json.Unmarshal([]byte(`{"criteria": [{"criteria_id": 4, "score": 1}], "K1_score": 1}`), &result)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []CriterionScore{{CriteriaID: 4, Score: 1}}, result.Criteria)
+}
+
+func TestDetailedResult_Marshal(t *testing.T) {
+	score := 1
+	result := DetailedResult{
+		Criteria: []CriterionScore{
+			{CriteriaID: 1, Code: "K1", Score: 1, Explanation: "ok"},
+			{CriteriaID: 11, Code: "EXTRA", Score: 0},
+		},
+		Score: &score,
+	}
+
+	data, err := json.Marshal(result)
+	assert.NoError(t, err)
+
+	var out map[string]any
+	assert.NoError(t, json.Unmarshal(data, &out))
+	assert.Len(t, out["criteria"], 2)
+	assert.Equal(t, float64(1), out["score"])
+	assert.Equal(t, float64(1), out["K1_score"])
+	assert.Equal(t, "ok", out["K1_explanation"])
+	assert.NotContains(t, out, "EXTRA_score")
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"essay/src/internal/mailer"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Purposes of account tokens.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// validateMail accepts a bare address like user@example.com.
+func validateMail(address string) error {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || !strings.Contains(address[strings.LastIndex(address, "@"):], ".") {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// newAccountToken stores a single-use token of purpose for the user and returns it
+// with its expiry. The token is "<payload>.<signature>", where payload is base64url of
+// "purpose:userID:expires:nonce" and signature its HMAC-SHA256 with s.Tokens.Key.
+// Only the hash of the token is stored. Returns ErrMailCooldown if an unused token of
+// the same purpose was issued less than s.Tokens.MailCooldown ago.
+func (s *UserService) newAccountToken(tx *sql.Tx, userID uint64, purpose string, ttl time.Duration) (string, time.Time, error) {
+	if len(s.Tokens.Key) == 0 {
+		return "", time.Time{}, errors.New("token key is empty")
+	}
+
+	// строка пользователя блокируется, чтобы параллельные запросы не обошли паузу
+	var recent bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM account_token
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL AND created_at > $3
+		)
+		FROM "user" WHERE id = $1
+		FOR UPDATE`, userID, purpose, time.Now().Add(-s.Tokens.MailCooldown)).Scan(&recent)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if recent {
+		return "", time.Time{}, ErrMailCooldown
+	}
+
+	nonce, err := newSessionToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	payload := base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%s:%d:%d:%s", purpose, userID, expiresAt.Unix(), nonce)))
+	token := payload + "." + s.accountTokenSignature(payload)
+
+	// прежние неиспользованные ссылки того же назначения больше не действуют
+	_, err = tx.Exec(`DELETE FROM account_token WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_token (token_hash, user_id, purpose, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		tokenHash(token), userID, purpose, expiresAt)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+// useAccountToken checks the signature, purpose and expiry of the token and marks it
+// used. Returns the user of the token.
+func (s *UserService) useAccountToken(tx *sql.Tx, token, purpose string) (uint64, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || len(s.Tokens.Key) == 0 || !hmac.Equal([]byte(signature), []byte(s.accountTokenSignature(payload))) {
+		return 0, ErrInvalidAccountToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, ErrInvalidAccountToken
+	}
+	fields := strings.Split(string(decoded), ":")
+	if len(fields) != 4 || fields[0] != purpose {
+		return 0, ErrInvalidAccountToken
+	}
+	if expires, err := strconv.ParseInt(fields[2], 10, 64); err != nil || time.Now().Unix() >= expires {
+		return 0, ErrInvalidAccountToken
+	}
+
+	var userID uint64
+	err = tx.QueryRow(`
+		UPDATE account_token SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`, tokenHash(token), purpose).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidAccountToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (s *UserService) accountTokenSignature(payload string) string {
+	mac := hmac.New(sha256.New, s.Tokens.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sendVerification issues a verification link for the address of the user and mails it.
+func (s *UserService) sendVerification(userID uint64, address, nickname string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	token, expiresAt, err := s.newAccountToken(tx, userID, TokenVerifyEmail, s.Tokens.VerifyTTL)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(mailer.Message{
+		To:      address,
+		Subject: "Подтверждение адреса почты",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Чтобы подтвердить адрес почты, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не регистрировались, просто не отвечайте на это письмо.\n",
+			nickname, s.appLink("/verify-email", token), expiresAt.Format("02.01.2006 15:04 MST")),
+	})
+}
+
+func (s *UserService) appLink(path, token string) string {
+	return strings.TrimSuffix(s.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// VerifyEmail confirms the address of the user the token was sent to.
+func (s *UserService) VerifyEmail(token string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.useAccountToken(tx, token, TokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE "user" SET email_verified = TRUE WHERE id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ResendVerification mails a new verification link; the previous one stops working.
+// Returns ErrMailCooldown if the previous link was sent too recently.
+func (s *UserService) ResendVerification(userID uint64) error {
+	var address, nickname string
+	var verified bool
+	err := s.DB.QueryRow(`SELECT mail, nickname, email_verified FROM "user" WHERE id = $1`, userID).
+		Scan(&address, &nickname, &verified)
+	if err != nil {
+		return err
+	}
+	if verified {
+		return ErrEmailVerified
+	}
+	return s.sendVerification(userID, address, nickname)
+}
+
+// RequestPasswordReset queues a password reset link for the address and returns at
+// once: the lookup and the mail happen in SendPasswordResets, so neither the answer
+// nor its timing tells which addresses are registered.
+func (s *UserService) RequestPasswordReset(address string) error {
+	select {
+	case s.passwordResets <- address:
+		return nil
+	default:
+		return ErrMailQueueFull
+	}
+}
+
+// SendPasswordResets mails the links queued by RequestPasswordReset until stop is closed.
+func (s *UserService) SendPasswordResets(stop <-chan struct{}) {
+	for {
+		select {
+		case address := <-s.passwordResets:
+			if err := s.sendPasswordReset(address); err != nil {
+				log.Printf("Failed to send password reset mail: %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sendPasswordReset mails a password reset link to the address. An unknown address
+// and a repeated request within s.Tokens.MailCooldown are skipped silently.
+func (s *UserService) sendPasswordReset(address string) error {
+	var userID uint64
+	var nickname string
+	err := s.DB.QueryRow(`SELECT id, nickname FROM "user" WHERE mail = $1`, address).Scan(&userID, &nickname)
+	if err == sql.ErrNoRows {
+		log.Printf("Password reset requested for unknown address")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	token, expiresAt, err := s.newAccountToken(tx, userID, TokenResetPassword, s.Tokens.ResetTTL)
+	if err == ErrMailCooldown {
+		log.Printf("Password reset for user %d requested again too soon", userID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return s.Mailer.Send(mailer.Message{
+		To:      address,
+		Subject: "Восстановление пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Чтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует до %s. Если вы не запрашивали восстановление, просто не отвечайте на это письмо.\n",
+			nickname, s.appLink("/reset-password", token), expiresAt.Format("02.01.2006 15:04 MST")),
+	})
+}
+
+// ResetPassword sets a new password by a reset token and signs the user out
+// everywhere. The link came to the user's mailbox, so the address counts as verified.
+func (s *UserService) ResetPassword(token, newPassword string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := s.useAccountToken(tx, token, TokenResetPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE "user" SET "password" = $1, email_verified = TRUE WHERE id = $2`, hash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_session WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	// refresh-токены отзываются, а не удаляются: украденный токен после сброса попадёт в лог
+	if _, err := tx.Exec(`UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Password of user %d reset by mail", userID)
+	return nil
+}
+
+// requireVerifiedEmail returns ErrEmailNotVerified if the user has not confirmed the
+// address yet.
+func requireVerifiedEmail(q querier, userID uint64) error {
+	var verified bool
+	if err := q.QueryRow(`SELECT email_verified FROM "user" WHERE id = $1`, userID).Scan(&verified); err != nil {
+		return err
+	}
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// PurgeExpiredAccountTokens deletes verification and reset tokens that have expired.
+func (s *UserService) PurgeExpiredAccountTokens() (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM account_token WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"essay/src/internal/mailer"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const useAccountTokenQuery = `UPDATE account_token SET used_at = NOW()`
+
+type testMailer struct {
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func newAccountService(t *testing.T) (*UserService, sqlmock.Sqlmock, *testMailer) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	service := NewUserService(db)
+	service.Tokens.Key = []byte("token key")
+	service.AppURL = "https://essay.example.com/"
+	m := &testMailer{}
+	service.Mailer = m
+	return service, mock, m
+}
+
+// expectAccountToken expects newAccountToken to issue a token and returns the stored hash.
+func expectAccountToken(mock sqlmock.Sqlmock, userID uint64, purpose string) *captureArg {
+	mock.ExpectQuery(`SELECT EXISTS\(\s+SELECT 1 FROM account_token`).
+		WithArgs(userID, purpose, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM account_token WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`)).
+		WithArgs(userID, purpose).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	stored := &captureArg{}
+	mock.ExpectExec(`INSERT INTO account_token`).
+		WithArgs(stored, userID, purpose, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	return stored
+}
+
+// testAccountToken signs a token like newAccountToken does.
+func testAccountToken(s *UserService, purpose string, userID uint64, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d:%d:nonce", purpose, userID, expiresAt.Unix())))
+	return payload + "." + s.accountTokenSignature(payload)
+}
+
+func TestValidateMail(t *testing.T) {
+	for address, valid := range map[string]bool{
+		"user1@example.com":          true,
+		"first.last@mail.example.ru": true,
+		"":                           false,
+		"user":                       false,
+		"user@localhost":             false,
+		"User <user@example.com>":    false,
+		"user@example.com ":          false,
+	} {
+		err := validateMail(address)
+		if valid {
+			assert.NoError(t, err, address)
+		} else {
+			assert.Equal(t, ErrInvalidEmail, err, address)
+		}
+	}
+}
+
+func TestUserService_PasswordReset(t *testing.T) {
+	service, mock, sent := newAccountService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, nickname FROM "user" WHERE mail = $1`)).
+		WithArgs("user1@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "nickname"}).AddRow(1, "User1"))
+	mock.ExpectBegin()
+	stored := expectAccountToken(mock, 1, TokenResetPassword)
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.sendPasswordReset("user1@example.com"))
+	if !assert.Len(t, sent.sent, 1) {
+		return
+	}
+	assert.Equal(t, "user1@example.com", sent.sent[0].To)
+
+	// токен из ссылки в письме
+	start := strings.Index(sent.sent[0].Body, "https://essay.example.com/reset-password?")
+	if !assert.NotEqual(t, -1, start) {
+		return
+	}
+	link, err := url.Parse(strings.Fields(sent.sent[0].Body[start:])[0])
+	assert.NoError(t, err)
+	token := link.Query().Get("token")
+	assert.Equal(t, tokenHash(token), stored.value)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(useAccountTokenQuery)).
+		WithArgs(tokenHash(token), TokenResetPassword).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET "password" = $1, email_verified = TRUE WHERE id = $2`)).
+		WithArgs(sqlmock.AnyArg(), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE user_id = $1`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ResetPassword(token, "new password"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RequestPasswordReset_Queued(t *testing.T) {
+	service, mock, sent := newAccountService(t)
+
+	// запрос только ставится в очередь: ответ не зависит от того, есть ли адрес в базе
+	assert.NoError(t, service.RequestPasswordReset("nobody@example.com"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, nickname FROM "user" WHERE mail = $1`)).
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		service.SendPasswordResets(stop)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+	close(stop)
+	<-done
+
+	assert.Empty(t, sent.sent)
+}
+
+func TestUserService_RequestPasswordReset_QueueFull(t *testing.T) {
+	service, _, _ := newAccountService(t)
+	service.passwordResets = make(chan string, 1)
+
+	assert.NoError(t, service.RequestPasswordReset("user1@example.com"))
+	assert.Equal(t, ErrMailQueueFull, service.RequestPasswordReset("user1@example.com"))
+}
+
+func TestUserService_PasswordReset_Cooldown(t *testing.T) {
+	service, mock, sent := newAccountService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, nickname FROM "user" WHERE mail = $1`)).
+		WithArgs("user1@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "nickname"}).AddRow(1, "User1"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS\(\s+SELECT 1 FROM account_token`).
+		WithArgs(uint64(1), TokenResetPassword, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	assert.NoError(t, service.sendPasswordReset("user1@example.com"))
+	assert.Empty(t, sent.sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ResendVerification_Cooldown(t *testing.T) {
+	service, mock, sent := newAccountService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT mail, nickname, email_verified FROM "user" WHERE id = $1`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"mail", "nickname", "email_verified"}).AddRow("user1@example.com", "User1", false))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS\(\s+SELECT 1 FROM account_token`).
+		WithArgs(uint64(1), TokenVerifyEmail, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	assert.Equal(t, ErrMailCooldown, service.ResendVerification(1))
+	assert.Empty(t, sent.sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_VerifyEmail(t *testing.T) {
+	service, mock, _ := newAccountService(t)
+	token := testAccountToken(service, TokenVerifyEmail, 2, time.Now().Add(time.Hour))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(useAccountTokenQuery)).
+		WithArgs(tokenHash(token), TokenVerifyEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET email_verified = TRUE WHERE id = $1`)).
+		WithArgs(uint64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.VerifyEmail(token))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_VerifyEmail_InvalidToken(t *testing.T) {
+	service, mock, _ := newAccountService(t)
+	valid := testAccountToken(service, TokenVerifyEmail, 2, time.Now().Add(time.Hour))
+	payload, _, _ := strings.Cut(valid, ".")
+
+	// эти токены отклоняются без обращения к таблице
+	tests := map[string]string{
+		"reset token":   testAccountToken(service, TokenResetPassword, 2, time.Now().Add(time.Hour)),
+		"expired":       testAccountToken(service, TokenVerifyEmail, 2, time.Now().Add(-time.Minute)),
+		"bad signature": payload + ".c2lnbmF0dXJl",
+		"garbage":       "abc",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+			assert.Equal(t, ErrInvalidAccountToken, service.VerifyEmail(token))
+		})
+	}
+
+	// подпись верна, но ссылкой уже воспользовались
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(useAccountTokenQuery)).
+		WithArgs(tokenHash(valid), TokenVerifyEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+	assert.Equal(t, ErrInvalidAccountToken, service.VerifyEmail(valid))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ResendVerification_Verified(t *testing.T) {
+	service, mock, sent := newAccountService(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT mail, nickname, email_verified FROM "user" WHERE id = $1`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"mail", "nickname", "email_verified"}).AddRow("user1@example.com", "User1", true))
+
+	assert.Equal(t, ErrEmailVerified, service.ResendVerification(1))
+	assert.Empty(t, sent.sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,597 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Appeal statuses.
+const (
+	AppealFiled    = "filed"
+	AppealClaimed  = "claimed"
+	AppealResolved = "resolved"
+	AppealRejected = "rejected"
+)
+
+// AppealRules limit who can appeal and when. A zero Window or MonthlyQuota turns the
+// corresponding limit off.
+type AppealRules struct {
+	Window       time.Duration // сколько времени после проверки можно подать апелляцию
+	MonthlyQuota int           // сколько апелляций пользователь может подать за календарный месяц
+}
+
+// DefaultAppealRules are used until the application sets its own.
+var DefaultAppealRules = AppealRules{
+	Window:       7 * 24 * time.Hour,
+	MonthlyQuota: 3,
+}
+
+// FileAppeal moves a checked essay to appeal, unpublishes it and stores the appeal with
+// the student's reasons per criterion in one transaction. Every appealed criterion needs
+// a reason, and the appeal must pass s.AppealRules. Returns the appeal ID.
+func (s *UserService) FileAppeal(essay *models.Essay, appealText string, criteria []models.AppealCriterion) (uint64, error) {
+	if len(criteria) == 0 {
+		return 0, fmt.Errorf("%w: name at least one criterion", ErrInvalidAppeal)
+	}
+	for _, c := range criteria {
+		if strings.TrimSpace(c.Reason) == "" {
+			return 0, fmt.Errorf("%w: criterion %d %q needs a reason", ErrInvalidAppeal, c.CriteriaID, c.Code)
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkAppealRules(tx, essay); err != nil {
+		return 0, err
+	}
+
+	err = changeStatus(tx, essay.ID, essay.Status, StatusAppeal,
+		models.Actor{Kind: ActorUser, UserID: essay.UserID}, "appeal filed")
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE essay SET is_published = false WHERE id = $1`, essay.ID); err != nil {
+		return 0, err
+	}
+
+	if err := resolveAppealCriteria(tx, essay.ID, criteria); err != nil {
+		return 0, err
+	}
+
+	var appealID uint64
+	// запоминаем обжалуемый результат, чтобы показать исходные баллы рядом с новыми
+	err = tx.QueryRow(`
+		INSERT INTO appeal (essay_id, user_id, appeal_text, original_result_id)
+		VALUES ($1, $2, $3, (SELECT id FROM result WHERE essay_id = $1 ORDER BY id DESC LIMIT 1))
+		RETURNING id`,
+		essay.ID, essay.UserID, appealText).Scan(&appealID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, c := range criteria {
+		_, err := tx.Exec(`INSERT INTO appeal_criteria (appeal_id, criteria_id, reason) VALUES ($1, $2, $3)`,
+			appealID, c.CriteriaID, c.Reason)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return appealID, nil
+}
+
+// checkAppealRules makes sure the essay was never appealed, is still within the appeal
+// window and the user has appeals left this month. The user row stays locked until the
+// end of tx so parallel appeals of one user are counted one after another.
+func (s *UserService) checkAppealRules(tx *sql.Tx, essay *models.Essay) error {
+	var locked uint64
+	if err := tx.QueryRow(`SELECT id FROM "user" WHERE id = $1 FOR UPDATE`, essay.UserID).Scan(&locked); err != nil {
+		return err
+	}
+
+	var exists bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM appeal WHERE essay_id = $1)`, essay.ID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAppealExists
+	}
+
+	if s.AppealRules.Window > 0 {
+		var checkedAt sql.NullTime
+		err := tx.QueryRow(`SELECT MAX(created_at) FROM essay_status_history WHERE essay_id = $1 AND to_status = $2`,
+			essay.ID, StatusChecked).Scan(&checkedAt)
+		if err != nil {
+			return err
+		}
+		// сочинения, проверенные до появления истории статусов, отсчитываем от даты написания
+		if !checkedAt.Valid {
+			checkedAt.Time = essay.CompletedAt
+		}
+		if time.Since(checkedAt.Time) > s.AppealRules.Window {
+			return ErrAppealWindowClosed
+		}
+	}
+
+	if s.AppealRules.MonthlyQuota > 0 {
+		used, err := countMonthAppeals(tx, essay.UserID)
+		if err != nil {
+			return err
+		}
+		if used >= s.AppealRules.MonthlyQuota {
+			return ErrAppealQuotaExceeded
+		}
+	}
+
+	return nil
+}
+
+// countMonthAppeals counts appeals the user filed since the start of the current month.
+func countMonthAppeals(q querier, userID uint64) (int, error) {
+	var count int
+	err := q.QueryRow(`SELECT COUNT(*) FROM appeal WHERE user_id = $1 AND created_at >= date_trunc('month', NOW())`,
+		userID).Scan(&count)
+	return count, err
+}
+
+// GetRemainingAppeals returns how many appeals the user can still file this month,
+// or nil when appeals are not limited.
+func (s *UserService) GetRemainingAppeals(userID uint64) (*int, error) {
+	if s.AppealRules.MonthlyQuota <= 0 {
+		return nil, nil
+	}
+
+	used, err := countMonthAppeals(s.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := max(s.AppealRules.MonthlyQuota-used, 0)
+	return &remaining, nil
+}
+
+// resolveAppealCriteria fills criteria IDs from codes using the essay rubric.
+func resolveAppealCriteria(q querier, essayID uint64, criteria []models.AppealCriterion) error {
+	if len(criteria) == 0 {
+		return nil
+	}
+
+	rubricVersionID, _, err := essayRubricVersion(q, essayID)
+	if err != nil {
+		return err
+	}
+	rubric, err := getCriteria(q, rubricVersionID)
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint64]models.Criteria, len(rubric))
+	byCode := make(map[string]models.Criteria, len(rubric))
+	for _, c := range rubric {
+		byID[c.ID] = c
+		byCode[c.Code] = c
+	}
+
+	seen := make(map[uint64]bool, len(criteria))
+	for i := range criteria {
+		c, ok := byID[criteria[i].CriteriaID]
+		if criteria[i].CriteriaID == 0 {
+			c, ok = byCode[criteria[i].Code]
+		}
+		if !ok {
+			return fmt.Errorf("%w: unknown criterion %d %q", ErrInvalidAppeal, criteria[i].CriteriaID, criteria[i].Code)
+		}
+		if seen[c.ID] {
+			return fmt.Errorf("%w: criterion %s is repeated", ErrInvalidAppeal, c.Code)
+		}
+		seen[c.ID] = true
+		criteria[i].CriteriaID = c.ID
+		criteria[i].Code = c.Code
+	}
+
+	return nil
+}
+
+// GetAppeal returns the appeal with its criteria.
+func (s *UserService) GetAppeal(appealID uint64) (*models.Appeal, error) {
+	var a models.Appeal
+	err := s.DB.QueryRow(`
+		SELECT id, essay_id, user_id, status, COALESCE(appeal_text, ''), COALESCE(moderator_id, 0), claimed_at,
+			COALESCE(resolution_comment, ''), COALESCE(result_id, 0), created_at, resolved_at
+		FROM appeal
+		WHERE id = $1`, appealID).Scan(
+		&a.ID, &a.EssayID, &a.UserID, &a.Status, &a.AppealText, &a.ModeratorID, &a.ClaimedAt,
+		&a.ResolutionComment, &a.ResultID, &a.CreatedAt, &a.ResolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT ac.criteria_id, c.code, COALESCE(ac.reason, ''), ac.decision_score, COALESCE(ac.decision_comment, '')
+		FROM appeal_criteria ac
+		JOIN criteria c ON c.id = ac.criteria_id
+		WHERE ac.appeal_id = $1
+		ORDER BY ac.criteria_id`, appealID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	a.Criteria = []models.AppealCriterion{}
+	for rows.Next() {
+		var c models.AppealCriterion
+		if err := rows.Scan(&c.CriteriaID, &c.Code, &c.Reason, &c.DecisionScore, &c.DecisionComment); err != nil {
+			return nil, err
+		}
+		a.Criteria = append(a.Criteria, c)
+	}
+
+	return &a, rows.Err()
+}
+
+// GetOpenAppealID returns the filed or claimed appeal of the essay.
+func (s *UserService) GetOpenAppealID(essayID uint64) (uint64, error) {
+	var id uint64
+	err := s.DB.QueryRow(`
+		SELECT id FROM appeal
+		WHERE essay_id = $1 AND status IN ('filed', 'claimed')
+		ORDER BY id DESC
+		LIMIT 1`, essayID).Scan(&id)
+	return id, err
+}
+
+// ClaimAppeal assigns a filed appeal to the moderator. Claiming an appeal the moderator
+// already holds renews the claim.
+func (s *UserService) ClaimAppeal(appealID, moderatorID uint64) error {
+	res, err := s.DB.Exec(`
+		UPDATE appeal SET status = 'claimed', moderator_id = $2, claimed_at = NOW()
+		WHERE id = $1 AND (status = 'filed' OR (status = 'claimed' AND moderator_id = $2))`,
+		appealID, moderatorID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return s.appealConflict(appealID)
+	}
+	return nil
+}
+
+// ReleaseAppeal returns an appeal claimed by the moderator to the queue.
+func (s *UserService) ReleaseAppeal(appealID, moderatorID uint64) error {
+	res, err := s.DB.Exec(`
+		UPDATE appeal SET status = 'filed', moderator_id = NULL, claimed_at = NULL
+		WHERE id = $1 AND status = 'claimed' AND moderator_id = $2`,
+		appealID, moderatorID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return s.appealConflict(appealID)
+	}
+	return nil
+}
+
+// appealConflict explains why the appeal could not be changed.
+func (s *UserService) appealConflict(appealID uint64) error {
+	var status string
+	if err := s.DB.QueryRow(`SELECT status FROM appeal WHERE id = $1`, appealID).Scan(&status); err != nil {
+		return err
+	}
+	return appealStatusError(status)
+}
+
+func appealStatusError(status string) error {
+	switch status {
+	case AppealClaimed:
+		return ErrAppealClaimed
+	case AppealFiled:
+		return ErrAppealNotClaimed
+	default:
+		return ErrAppealClosed
+	}
+}
+
+// lockAppeal locks the appeal until the end of tx and makes sure the moderator holds it.
+// A filed appeal is claimed on the way. Returns the essay ID.
+func lockAppeal(tx *sql.Tx, appealID, moderatorID uint64) (uint64, error) {
+	var essayID, holder uint64
+	var status string
+	err := tx.QueryRow(`SELECT essay_id, status, COALESCE(moderator_id, 0) FROM appeal WHERE id = $1 FOR UPDATE`,
+		appealID).Scan(&essayID, &status, &holder)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case status == AppealClaimed && holder == moderatorID:
+		return essayID, nil
+	case status == AppealFiled:
+		_, err := tx.Exec(`UPDATE appeal SET status = 'claimed', moderator_id = $2, claimed_at = NOW() WHERE id = $1`,
+			appealID, moderatorID)
+		return essayID, err
+	default:
+		return 0, appealStatusError(status)
+	}
+}
+
+// ResolveAppeal stores the moderator's result, records the decision on each appealed
+// criterion and moves the essay from appeal to appealed in one transaction. The result
+// revises only the appealed criteria, the other scores are carried over from the
+// appealed result.
+func (s *UserService) ResolveAppeal(appealID, moderatorID uint64, result *models.DetailedResult, comment string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	essayID, err := lockAppeal(tx, appealID, moderatorID)
+	if err != nil {
+		return err
+	}
+	if err := lockEssayStatus(tx, essayID, StatusAppeal); err != nil {
+		return err
+	}
+
+	rubricVersionID, rubricCode, err := essayRubricVersion(tx, essayID)
+	if err != nil {
+		return err
+	}
+	criteria, err := getCriteria(tx, rubricVersionID)
+	if err != nil {
+		return err
+	}
+	original, err := appealedScores(tx, appealID)
+	if err != nil {
+		return err
+	}
+	if err := mergeAppealResult(result, original, rubricCode, criteria); err != nil {
+		return err
+	}
+	if err := validateResult(result, rubricCode, criteria); err != nil {
+		return err
+	}
+
+	resultID, err := insertResult(tx, result, essayID, "", rubricVersionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE appeal_criteria ac
+		SET decision_score = rc.score, decision_comment = rc.explanation
+		FROM result_criteria rc
+		WHERE ac.appeal_id = $1 AND rc.result_id = $2 AND rc.criteria_id = ac.criteria_id`,
+		appealID, resultID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE appeal SET status = 'resolved', resolution_comment = $2, result_id = $3, resolved_at = NOW()
+		WHERE id = $1`, appealID, comment, resultID)
+	if err != nil {
+		return err
+	}
+
+	err = changeStatus(tx, essayID, StatusAppeal, StatusAppealed,
+		models.Actor{Kind: ActorModerator, UserID: moderatorID}, "appeal resolved")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appealedScore is a score of the appealed result and whether the student disputes it.
+type appealedScore struct {
+	models.CriterionScore
+	Appealed bool
+}
+
+// appealedScores returns scores of the result the appeal disputes in criteria order.
+// Appeals filed without a stored result have none.
+func appealedScores(q querier, appealID uint64) ([]appealedScore, error) {
+	rows, err := q.Query(`
+		SELECT rc.criteria_id, rc.score, COALESCE(rc.explanation, ''), ac.criteria_id IS NOT NULL
+		FROM appeal a
+		JOIN result_criteria rc ON rc.result_id = a.original_result_id
+		LEFT JOIN appeal_criteria ac ON ac.appeal_id = a.id AND ac.criteria_id = rc.criteria_id
+		WHERE a.id = $1
+		ORDER BY rc.criteria_id`, appealID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var scores []appealedScore
+	for rows.Next() {
+		var sc appealedScore
+		if err := rows.Scan(&sc.CriteriaID, &sc.Score, &sc.Explanation, &sc.Appealed); err != nil {
+			return nil, err
+		}
+		scores = append(scores, sc)
+	}
+
+	return scores, rows.Err()
+}
+
+// mergeAppealResult turns the moderator's revision into a full result. Appealed criteria
+// take the revised score, or keep the original one when the moderator left them out.
+// The other criteria are carried over; a revision that changes them is rejected.
+// Carried over criteria that a dependency rule zeroes become 0.
+func mergeAppealResult(revised *models.DetailedResult, original []appealedScore, rubricCode string, criteria []models.Criteria) error {
+	// без исходного результата модератор выставляет все баллы заново
+	if len(original) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint64]models.Criteria, len(criteria))
+	byCode := make(map[string]models.Criteria, len(criteria))
+	for _, c := range criteria {
+		byID[c.ID] = c
+		byCode[c.Code] = c
+	}
+
+	verr := &ValidationError{}
+	revisions := make(map[uint64]models.CriterionScore, len(revised.Criteria))
+	var unknown []models.CriterionScore
+	for _, entry := range revised.Criteria {
+		c, ok := byID[entry.CriteriaID]
+		if entry.CriteriaID == 0 {
+			c, ok = byCode[entry.Code]
+		}
+		if !ok {
+			// неизвестные критерии отклонит validateResult
+			unknown = append(unknown, entry)
+			continue
+		}
+		revisions[c.ID] = entry
+	}
+
+	merged := make([]models.CriterionScore, 0, len(original)+len(unknown))
+	codes := make(map[string]int, len(original))
+	for _, o := range original {
+		entry := o.CriterionScore
+		if r, ok := revisions[o.CriteriaID]; ok {
+			if o.Appealed {
+				entry = r
+				entry.CriteriaID = o.CriteriaID
+			} else if r.Score != o.Score {
+				verr.add(byID[o.CriteriaID].Code, "criterion was not appealed")
+			}
+		}
+		codes[byID[o.CriteriaID].Code] = len(merged)
+		merged = append(merged, entry)
+	}
+
+	for _, rule := range dependencyRules[rubricCode] {
+		if i, ok := codes[rule.If]; !ok || merged[i].Score != 0 {
+			continue
+		}
+		for _, code := range rule.Dependent {
+			i, ok := codes[code]
+			if ok && !original[i].Appealed && merged[i].Score != 0 {
+				merged[i].Score = 0
+				merged[i].Explanation = fmt.Sprintf("0 баллов, так как по %s выставлено 0", rule.If)
+			}
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	revised.Criteria = append(merged, unknown...)
+	return nil
+}
+
+// GetAppealReview returns the latest appeal of the essay with original and revised
+// scores per criterion, or nil when the essay was never appealed.
+func (s *UserService) GetAppealReview(essayID uint64) (*models.AppealReview, error) {
+	var review models.AppealReview
+	err := s.DB.QueryRow(`
+		SELECT id, status, COALESCE(appeal_text, ''), COALESCE(resolution_comment, ''), resolved_at
+		FROM appeal
+		WHERE essay_id = $1
+		ORDER BY id DESC
+		LIMIT 1`, essayID).Scan(&review.ID, &review.Status, &review.AppealText, &review.ResolutionComment, &review.ResolvedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT c.id, c.code, c.title, c.max_score, o.score, n.score,
+			ac.criteria_id IS NOT NULL, COALESCE(ac.reason, ''), COALESCE(ac.decision_comment, '')
+		FROM appeal a
+		JOIN result_criteria o ON o.result_id = a.original_result_id
+		JOIN criteria c ON c.id = o.criteria_id
+		LEFT JOIN result_criteria n ON n.result_id = a.result_id AND n.criteria_id = o.criteria_id
+		LEFT JOIN appeal_criteria ac ON ac.appeal_id = a.id AND ac.criteria_id = o.criteria_id
+		WHERE a.id = $1
+		ORDER BY c.id`, review.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	review.Criteria = []models.AppealCriterionReview{}
+	for rows.Next() {
+		var c models.AppealCriterionReview
+		err := rows.Scan(&c.CriteriaID, &c.Code, &c.Title, &c.MaxScore, &c.OriginalScore, &c.RevisedScore,
+			&c.Appealed, &c.Reason, &c.Explanation)
+		if err != nil {
+			return nil, err
+		}
+		review.Criteria = append(review.Criteria, c)
+	}
+
+	return &review, rows.Err()
+}
+
+// RejectAppeal closes the appeal without a new result. The essay keeps its scores
+// and moves from appeal to appealed.
+func (s *UserService) RejectAppeal(appealID, moderatorID uint64, comment string) error {
+	if comment == "" {
+		return fmt.Errorf("%w: rejection needs a comment", ErrInvalidAppeal)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	essayID, err := lockAppeal(tx, appealID, moderatorID)
+	if err != nil {
+		return err
+	}
+	if err := lockEssayStatus(tx, essayID, StatusAppeal); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE appeal SET status = 'rejected', resolution_comment = $2, resolved_at = NOW() WHERE id = $1`,
+		appealID, comment)
+	if err != nil {
+		return err
+	}
+
+	err = changeStatus(tx, essayID, StatusAppeal, StatusAppealed,
+		models.Actor{Kind: ActorModerator, UserID: moderatorID}, "appeal rejected")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReleaseStaleAppealClaims returns appeals claimed longer than timeout ago to the queue.
+func (s *UserService) ReleaseStaleAppealClaims(timeout time.Duration) (int64, error) {
+	res, err := s.DB.Exec(`
+		UPDATE appeal SET status = 'filed', moderator_id = NULL, claimed_at = NULL
+		WHERE status = 'claimed' AND claimed_at < $1`, time.Now().Add(-timeout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
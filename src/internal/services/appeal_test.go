@@ -0,0 +1,378 @@
+package services
+
+import (
+	"errors"
+	"essay/src/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// testAppealRules differ from DefaultAppealRules so the tests do not depend on the defaults.
+var testAppealRules = AppealRules{
+	Window:       5 * 24 * time.Hour,
+	MonthlyQuota: 2,
+}
+
+// expectAppealRules expects the checks of rules made by FileAppeal for an essay checked
+// at checkedAt whose author filed used appeals this month.
+func expectAppealRules(mock sqlmock.Sqlmock, rules AppealRules, essayID, userID uint64, exists bool, checkedAt time.Time, used int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS(SELECT 1 FROM appeal WHERE essay_id = $1)`)).
+		WithArgs(essayID).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+	if exists {
+		return
+	}
+	if rules.Window > 0 {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT MAX(created_at) FROM essay_status_history WHERE essay_id = $1 AND to_status = $2`)).
+			WithArgs(essayID, StatusChecked).
+			WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(checkedAt))
+		if time.Since(checkedAt) > rules.Window {
+			return
+		}
+	}
+	if rules.MonthlyQuota <= 0 {
+		return
+	}
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appeal WHERE user_id = \$1`).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(used))
+}
+
+func TestUserService_FileAppeal(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.AppealRules = testAppealRules
+	essay := &models.Essay{ID: 7, UserID: 10, Status: StatusChecked}
+
+	mock.ExpectBegin()
+	expectAppealRules(mock, service.AppealRules, 7, 10, false, time.Now().Add(-time.Hour), 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusAppeal, uint64(7), StatusChecked).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(uint64(7), StatusChecked, StatusAppeal, ActorUser, uint64(10), "appeal filed").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET is_published = false WHERE id = $1`)).
+		WithArgs(uint64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT rv.id, r.code`).
+		WithArgs(uint64(7), DefaultRubricCode).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ege"))
+	mock.ExpectQuery(`SELECT id, code, title, max_score FROM "criteria"`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score"}).
+			AddRow(1, "K1", "Позиция автора", 1).
+			AddRow(2, "K2", "Комментарий", 3))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO appeal (essay_id, user_id, appeal_text, original_result_id)`)).
+		WithArgs(uint64(7), uint64(10), "не согласен").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO appeal_criteria (appeal_id, criteria_id, reason) VALUES ($1, $2, $3)`)).
+		WithArgs(uint64(3), uint64(2), "пример есть").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	id, err := service.FileAppeal(essay, "не согласен", []models.AppealCriterion{{Code: "K2", Reason: "пример есть"}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_FileAppeal_UnknownCriterion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.AppealRules = testAppealRules
+	essay := &models.Essay{ID: 7, UserID: 10, Status: StatusChecked}
+
+	mock.ExpectBegin()
+	expectAppealRules(mock, service.AppealRules, 7, 10, false, time.Now().Add(-time.Hour), 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET is_published = false WHERE id = $1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT rv.id, r.code`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ege"))
+	mock.ExpectQuery(`SELECT id, code, title, max_score FROM "criteria"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score"}).AddRow(1, "K1", "Позиция автора", 1))
+	mock.ExpectRollback()
+
+	_, err := service.FileAppeal(essay, "", []models.AppealCriterion{{Code: "K9", Reason: "?"}})
+	assert.True(t, errors.Is(err, ErrInvalidAppeal))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_FileAppeal_Rules(t *testing.T) {
+	tests := []struct {
+		name      string
+		exists    bool
+		checkedAt time.Time
+		used      int
+		want      error
+	}{
+		{"already appealed", true, time.Now(), 0, ErrAppealExists},
+		{"window closed", false, time.Now().Add(-testAppealRules.Window - time.Hour), 0, ErrAppealWindowClosed},
+		{"quota exceeded", false, time.Now(), testAppealRules.MonthlyQuota, ErrAppealQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+
+			service := NewUserService(db)
+			service.AppealRules = testAppealRules
+			essay := &models.Essay{ID: 7, UserID: 10, Status: StatusChecked}
+
+			mock.ExpectBegin()
+			expectAppealRules(mock, service.AppealRules, 7, 10, tt.exists, tt.checkedAt, tt.used)
+			mock.ExpectRollback()
+
+			_, err := service.FileAppeal(essay, "", []models.AppealCriterion{{Code: "K2", Reason: "пример есть"}})
+			assert.Equal(t, tt.want, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserService_GetRemainingAppeals(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.AppealRules.MonthlyQuota = 3
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM appeal WHERE user_id = \$1`).
+		WithArgs(uint64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	remaining, err := service.GetRemainingAppeals(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *remaining)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	service.AppealRules.MonthlyQuota = 0
+	remaining, err = service.GetRemainingAppeals(10)
+	assert.NoError(t, err)
+	assert.Nil(t, remaining)
+}
+
+func TestUserService_FileAppeal_NeedsReasons(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	essay := &models.Essay{ID: 7, UserID: 10, Status: StatusChecked}
+
+	_, err := service.FileAppeal(essay, "не согласен", nil)
+	assert.True(t, errors.Is(err, ErrInvalidAppeal))
+
+	_, err = service.FileAppeal(essay, "не согласен", []models.AppealCriterion{{Code: "K2", Reason: " "}})
+	assert.True(t, errors.Is(err, ErrInvalidAppeal))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func appealTestCriteria() []models.Criteria {
+	return []models.Criteria{
+		{ID: 1, Code: "K1", Title: "Позиция автора", MaxScore: 1},
+		{ID: 2, Code: "K2", Title: "Комментарий", MaxScore: 3},
+		{ID: 3, Code: "K3", Title: "Своё отношение", MaxScore: 2},
+	}
+}
+
+func appealTestScores() []appealedScore {
+	return []appealedScore{
+		{CriterionScore: models.CriterionScore{CriteriaID: 1, Score: 1, Explanation: "позиция есть"}, Appealed: true},
+		{CriterionScore: models.CriterionScore{CriteriaID: 2, Score: 1, Explanation: "один пример"}, Appealed: true},
+		{CriterionScore: models.CriterionScore{CriteriaID: 3, Score: 2, Explanation: "обосновано"}},
+	}
+}
+
+func TestMergeAppealResult_CarriesOverNotAppealed(t *testing.T) {
+	result := &models.DetailedResult{Criteria: []models.CriterionScore{
+		{Code: "K2", Score: 3, Explanation: "оба примера пояснены"},
+		{Code: "K3", Score: 2, Explanation: "без изменений"},
+	}}
+
+	err := mergeAppealResult(result, appealTestScores(), "ege", appealTestCriteria())
+	assert.NoError(t, err)
+	if assert.Len(t, result.Criteria, 3) {
+		assert.Equal(t, 1, result.Criteria[0].Score)
+		assert.Equal(t, "позиция есть", result.Criteria[0].Explanation)
+		assert.Equal(t, uint64(2), result.Criteria[1].CriteriaID)
+		assert.Equal(t, 3, result.Criteria[1].Score)
+		assert.Equal(t, "оба примера пояснены", result.Criteria[1].Explanation)
+		assert.Equal(t, "обосновано", result.Criteria[2].Explanation)
+	}
+}
+
+func TestMergeAppealResult_RejectsNotAppealedChanges(t *testing.T) {
+	result := &models.DetailedResult{Criteria: []models.CriterionScore{
+		{Code: "K3", Score: 1},
+	}}
+
+	err := mergeAppealResult(result, appealTestScores(), "ege", appealTestCriteria())
+	var verr *ValidationError
+	if assert.True(t, errors.As(err, &verr)) {
+		assert.Equal(t, []FieldError{{Field: "K3", Message: "criterion was not appealed"}}, verr.Fields)
+	}
+}
+
+func TestMergeAppealResult_ZeroesDependentCriteria(t *testing.T) {
+	criteria := append(appealTestCriteria(), models.Criteria{ID: 4, Code: "K4", Title: "Фактическая точность", MaxScore: 1})
+	original := []appealedScore{
+		{CriterionScore: models.CriterionScore{CriteriaID: 1, Score: 1}, Appealed: true},
+		{CriterionScore: models.CriterionScore{CriteriaID: 2, Score: 2}},
+		{CriterionScore: models.CriterionScore{CriteriaID: 3, Score: 2}},
+		{CriterionScore: models.CriterionScore{CriteriaID: 4, Score: 1}},
+	}
+	result := &models.DetailedResult{Criteria: []models.CriterionScore{{Code: "K1", Score: 0}}}
+
+	assert.NoError(t, mergeAppealResult(result, original, "ege", criteria))
+	for _, c := range result.Criteria {
+		assert.Equal(t, 0, c.Score)
+	}
+	assert.NoError(t, validateResult(result, "ege", criteria))
+}
+
+func TestUserService_GetAppealReview(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`SELECT id, status, COALESCE\(appeal_text, ''\), COALESCE\(resolution_comment, ''\), resolved_at`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "appeal_text", "resolution_comment", "resolved_at"}).
+			AddRow(3, AppealResolved, "не согласен", "", time.Now()))
+	mock.ExpectQuery(`JOIN result_criteria o ON o.result_id = a.original_result_id`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score", "original", "revised", "appealed", "reason", "explanation"}).
+			AddRow(1, "K1", "Позиция автора", 1, 1, 1, false, "", "").
+			AddRow(2, "K2", "Комментарий", 3, 1, 3, true, "пример есть", "оба примера пояснены"))
+
+	review, err := service.GetAppealReview(7)
+	assert.NoError(t, err)
+	if assert.Len(t, review.Criteria, 2) {
+		assert.Equal(t, 1, review.Criteria[1].OriginalScore)
+		assert.Equal(t, 3, *review.Criteria[1].RevisedScore)
+		assert.Equal(t, "оба примера пояснены", review.Criteria[1].Explanation)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_GetAppealReview_NoAppeal(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`FROM appeal`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "status", "appeal_text", "resolution_comment", "resolved_at"}))
+
+	review, err := service.GetAppealReview(7)
+	assert.NoError(t, err)
+	assert.Nil(t, review)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ClaimAppeal(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectExec(`UPDATE appeal SET status = 'claimed'`).
+		WithArgs(uint64(3), uint64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, service.ClaimAppeal(3, 5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ClaimAppeal_Conflict(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectExec(`UPDATE appeal SET status = 'claimed'`).
+		WithArgs(uint64(3), uint64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT status FROM appeal WHERE id = $1`)).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(AppealClaimed))
+
+	assert.Equal(t, ErrAppealClaimed, service.ClaimAppeal(3, 5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RejectAppeal(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT essay_id, status, COALESCE\(moderator_id, 0\) FROM appeal WHERE id = \$1 FOR UPDATE`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"essay_id", "status", "moderator_id"}).AddRow(7, AppealFiled, 0))
+	mock.ExpectExec(`UPDATE appeal SET status = 'claimed'`).
+		WithArgs(uint64(3), uint64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`SELECT status FROM essay WHERE id = \$1 FOR UPDATE`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusAppeal))
+	mock.ExpectExec(`UPDATE appeal SET status = 'rejected'`).
+		WithArgs(uint64(3), "баллы выставлены верно").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusAppealed, uint64(7), StatusAppeal).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(uint64(7), StatusAppeal, StatusAppealed, ActorModerator, uint64(5), "appeal rejected").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.RejectAppeal(3, 5, "баллы выставлены верно"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RejectAppeal_NeedsComment(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	err := service.RejectAppeal(3, 5, "")
+	assert.True(t, errors.Is(err, ErrInvalidAppeal))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ReleaseStaleAppealClaims(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectExec(`UPDATE appeal SET status = 'filed', moderator_id = NULL, claimed_at = NULL`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	released, err := service.ReleaseStaleAppealClaims(30 * time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), released)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -3,7 +3,9 @@ package services
 import (
 	"database/sql"
 	"essay/src/internal/models"
+	"fmt"
 	"log"
+	"strings"
 )
 
 func (s *UserService) GetCounts() (int, int, int, error) {
@@ -17,7 +19,7 @@ func (s *UserService) GetCounts() (int, int, int, error) {
 		return 0, 0, 0, err
 	}
 
-	essays_query := `SELECT COUNT(*) FROM essay`
+	essays_query := `SELECT COUNT(*) FROM essay e WHERE ` + essayVisible
 	err = s.DB.QueryRow(essays_query).Scan(&essays_count)
 	if err != nil {
 		return 0, 0, 0, err
@@ -35,8 +37,8 @@ func (s *UserService) GetCounts() (int, int, int, error) {
 func (s *UserService) GetVariantByID(variantID uint64) (models.Variant, error) {
 	var variant models.Variant
 
-	query := `SELECT id, variant_title, variant_text FROM variant WHERE id = $1`
-	err := s.DB.QueryRow(query, variantID).Scan(&variant.ID, &variant.VariantTitle, &variant.VariantText)
+	query := `SELECT id, variant_title, variant_text, COALESCE(author_position, ''), COALESCE(rubric_version_id, 0) FROM variant WHERE id = $1`
+	err := s.DB.QueryRow(query, variantID).Scan(&variant.ID, &variant.VariantTitle, &variant.VariantText, &variant.AuthorPosition, &variant.RubricVersionID)
 
 	if err != nil {
 		return variant, err
@@ -48,10 +50,11 @@ func (s *UserService) GetVariantByID(variantID uint64) (models.Variant, error) {
 func (s *UserService) CreateVariant(variant models.Variant) (int, error) {
 	var insertedID int
 	query := `
-		INSERT INTO variant (variant_title, variant_text, author_position)  
-		VALUES ($1, $2, $3)  
+		INSERT INTO variant (variant_title, variant_text, author_position, rubric_version_id)  
+		VALUES ($1, $2, $3, COALESCE(NULLIF($4::INTEGER, 0), ` + fmt.Sprintf(latestRubricVersion, "$5") + `))  
 		RETURNING id;`
-	err := s.DB.QueryRow(query, variant.VariantTitle, variant.VariantText, variant.AuthorPosition).Scan(&insertedID)
+	err := s.DB.QueryRow(query, variant.VariantTitle, variant.VariantText, variant.AuthorPosition,
+		variant.RubricVersionID, DefaultRubricCode).Scan(&insertedID)
 
 	if err != nil {
 		return 0, err
@@ -181,63 +184,138 @@ func (s *UserService) AddComment(userID uint64, essayID uint64, text string) (mo
 	return comment, nil
 }
 
-func (s *UserService) CreateResult(result *models.DetailedResult, essayID uint64) error {
-	var resultID int
+// SaveCheckResult stores a checker result and moves the essay from saved to checked
+// in one transaction. A result already stored for the same essay and attempt is
+// reported as ErrResultExists.
+func (s *UserService) SaveCheckResult(checkResult *models.CheckResult) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	score := result.K1_score + result.K2_score + result.K3_score + result.K4_score +
-		result.K5_score + result.K6_score + result.K7_score + result.K8_score +
-		result.K9_score + result.K10_score
-	result.Score = &score
+	var exists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM result WHERE essay_id = $1 AND attempt_id = $2)`,
+		checkResult.EssayID, checkResult.AttemptID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrResultExists
+	}
 
-	err := s.DB.QueryRow(`
-		INSERT INTO result (sum_score, essay_id) 
-		VALUES ($1, $2) RETURNING id`,
-		result.Score, essayID,
-	).Scan(&resultID)
+	if err := lockEssayStatus(tx, checkResult.EssayID, StatusSaved); err != nil {
+		return err
+	}
+
+	if _, err := createResult(tx, &checkResult.LLMResponse, checkResult.EssayID, checkResult.AttemptID); err != nil {
+		return err
+	}
+
+	// попытка с результатом завершена, остальные ожидающие больше не нужны
+	_, err = tx.Exec(`
+		UPDATE check_attempt
+		SET status = CASE WHEN attempt_id = $2 OR $2 = '' THEN 'checked' ELSE 'superseded' END, finished_at = NOW()
+		WHERE essay_id = $1 AND (attempt_id = $2 OR status = 'pending')`,
+		checkResult.EssayID, checkResult.AttemptID)
 	if err != nil {
 		return err
 	}
-	log.Println("resultID ", resultID)
-
-	// Вставляем критерии оценки
-	criteriaScores := []struct {
-		Score       int
-		Explanation string
-		CriteriaID  int
-	}{
-		{result.K1_score, result.K1_explanation, 1},
-		{result.K2_score, result.K2_explanation, 2},
-		{result.K3_score, result.K3_explanation, 3},
-		{result.K4_score, result.K4_explanation, 4},
-		{result.K5_score, result.K5_explanation, 5},
-		{result.K6_score, result.K6_explanation, 6},
-		{result.K7_score, result.K7_explanation, 7},
-		{result.K8_score, result.K8_explanation, 8},
-		{result.K9_score, result.K9_explanation, 9},
-		{result.K10_score, result.K10_explanation, 10},
-	}
-
-	for _, c := range criteriaScores {
-		_, err = s.DB.Exec(`
-			INSERT INTO result_criteria (result_id, criteria_id, score, explanation)
-			VALUES ($1, $2, $3, $4)`,
-			resultID, c.CriteriaID, c.Score, c.Explanation,
-		)
-		if err != nil {
-			return err
-		}
+
+	err = changeStatus(tx, checkResult.EssayID, StatusSaved, StatusChecked,
+		models.Actor{Kind: ActorChecker}, "check result "+checkResult.AttemptID)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Resilt saved with ID:", resultID)
+	return tx.Commit()
+}
 
+// lockEssayStatus locks the essay row until the end of tx and checks its status.
+func lockEssayStatus(tx *sql.Tx, essayID uint64, status string) error {
+	var current string
+	err := tx.QueryRow(`SELECT status FROM essay WHERE id = $1 FOR UPDATE`, essayID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current != status {
+		return ErrWrongStatus
+	}
 	return nil
 }
 
-func (s *UserService) GetCriteria() ([]models.Criteria, error) {
+// createResult validates the result against the essay rubric and stores it with
+// all its criteria inside tx. Returns the ID of the new result.
+func createResult(tx *sql.Tx, result *models.DetailedResult, essayID uint64, attemptID string) (uint64, error) {
+	rubricVersionID, rubricCode, err := essayRubricVersion(tx, essayID)
+	if err != nil {
+		return 0, err
+	}
+	criteria, err := getCriteria(tx, rubricVersionID)
+	if err != nil {
+		return 0, err
+	}
+	if err := validateResult(result, rubricCode, criteria); err != nil {
+		return 0, err
+	}
+
+	return insertResult(tx, result, essayID, attemptID, rubricVersionID)
+}
+
+// insertResult stores an already validated result with all its criteria inside tx.
+func insertResult(tx *sql.Tx, result *models.DetailedResult, essayID uint64, attemptID string, rubricVersionID uint64) (uint64, error) {
+	var resultID uint64
+
+	score := 0
+	for _, c := range result.Criteria {
+		score += c.Score
+	}
+	result.Score = &score
+	result.RubricVersionID = rubricVersionID
+
+	err := tx.QueryRow(`
+		INSERT INTO result (sum_score, essay_id, attempt_id, rubric_version_id) 
+		VALUES ($1, $2, NULLIF($3, ''), $4)
+		ON CONFLICT (essay_id, attempt_id) DO NOTHING
+		RETURNING id`,
+		result.Score, essayID, attemptID, rubricVersionID,
+	).Scan(&resultID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrResultExists
+		}
+		return 0, err
+	}
+
+	// Вставляем критерии оценки одним запросом
+	values := make([]string, 0, len(result.Criteria))
+	args := make([]any, 0, 4*len(result.Criteria))
+	for i, c := range result.Criteria {
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d)", 4*i+1, 4*i+2, 4*i+3, 4*i+4))
+		args = append(args, resultID, c.CriteriaID, c.Score, c.Explanation)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO result_criteria (result_id, criteria_id, score, explanation)
+		VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Println("Result saved with ID:", resultID)
+
+	return resultID, nil
+}
+
+// GetCriteria returns criteria of the rubric version.
+func (s *UserService) GetCriteria(rubricVersionID uint64) ([]models.Criteria, error) {
+	return getCriteria(s.DB, rubricVersionID)
+}
+
+func getCriteria(q querier, rubricVersionID uint64) ([]models.Criteria, error) {
 	var criteria []models.Criteria
-	query := `SELECT id, title, max_score FROM "criteria" ORDER BY id`
+	query := `SELECT id, code, title, max_score FROM "criteria" WHERE rubric_version_id = $1 ORDER BY id`
 
-	rows, err := s.DB.Query(query)
+	rows, err := q.Query(query, rubricVersionID)
 	if err != nil {
 		return nil, err
 	}
@@ -245,7 +323,7 @@ func (s *UserService) GetCriteria() ([]models.Criteria, error) {
 
 	for rows.Next() {
 		var c models.Criteria
-		if err := rows.Scan(&c.ID, &c.Title, &c.MaxScore); err != nil {
+		if err := rows.Scan(&c.ID, &c.Code, &c.Title, &c.MaxScore); err != nil {
 			return nil, err
 		}
 		criteria = append(criteria, c)
@@ -258,18 +336,13 @@ func (s *UserService) GetCriteria() ([]models.Criteria, error) {
 	return criteria, nil
 }
 
-func (s *UserService) SetAppealText(essayID uint64, appealText string) error {
-	query := `UPDATE result SET appeal_text = $1 WHERE essay_id = $2`
-	_, err := s.DB.Exec(query, appealText, essayID)
-	return err
-}
-
 func (s *UserService) GetResultsByUserID(userID uint64) ([]models.ResultDate, error) {
 	query := `
-        SELECT e.completed_at, r.sum_score
+        SELECT e.completed_at, r.sum_score,
+            EXISTS(SELECT 1 FROM exam_session x WHERE x.essay_id = e.id)
         FROM result r
         JOIN essay e ON r.essay_id = e.id
-        WHERE e.user_id = $1
+        WHERE e.user_id = $1 AND e.deleted_at IS NULL AND e.archived_at IS NULL
         ORDER BY e.completed_at DESC
     `
 	rows, err := s.DB.Query(query, userID)
@@ -281,7 +354,7 @@ func (s *UserService) GetResultsByUserID(userID uint64) ([]models.ResultDate, er
 	var results []models.ResultDate
 	for rows.Next() {
 		var res models.ResultDate
-		if err := rows.Scan(&res.CompletedAt, &res.Score); err != nil {
+		if err := rows.Scan(&res.CompletedAt, &res.Score, &res.IsExam); err != nil {
 			return nil, err
 		}
 		results = append(results, res)
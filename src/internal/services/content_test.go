@@ -2,7 +2,9 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"essay/src/internal/models"
+	"regexp"
 	"testing"
 	"time"
 
@@ -118,3 +120,206 @@ func TestUserService_AddComment(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestUserService_SaveCheckResult_Duplicate(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM result WHERE essay_id = \$1 AND attempt_id = \$2\)`).
+		WithArgs(uint64(1), "a1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	err := service.SaveCheckResult(&models.CheckResult{EssayID: 1, AttemptID: "a1"})
+
+	assert.Equal(t, ErrResultExists, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_SaveCheckResult_WrongStatus(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM result WHERE essay_id = \$1 AND attempt_id = \$2\)`).
+		WithArgs(uint64(1), "a1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(`SELECT status FROM essay WHERE id = \$1 FOR UPDATE`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("checked"))
+	mock.ExpectRollback()
+
+	err := service.SaveCheckResult(&models.CheckResult{EssayID: 1, AttemptID: "a1"})
+
+	assert.Equal(t, ErrWrongStatus, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// resultStep sets up one expected statement of saving a result; fail makes it return errStep.
+type resultStep func(mock sqlmock.Sqlmock, fail bool)
+
+var errStep = errors.New("step failed")
+
+func checkResultSteps(essayID uint64, attemptID string) []resultStep {
+	return []resultStep{
+		func(mock sqlmock.Sqlmock, fail bool) {
+			q := mock.ExpectQuery(`SELECT EXISTS`).WithArgs(essayID, attemptID)
+			if fail {
+				q.WillReturnError(errStep)
+				return
+			}
+			q.WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			q := mock.ExpectQuery(`SELECT status FROM essay WHERE id = \$1 FOR UPDATE`).WithArgs(essayID)
+			if fail {
+				q.WillReturnError(errStep)
+				return
+			}
+			q.WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("saved"))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			q := mock.ExpectQuery(`SELECT rv.id, r.code`).WithArgs(essayID, DefaultRubricCode)
+			if fail {
+				q.WillReturnError(errStep)
+				return
+			}
+			q.WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ege"))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			q := mock.ExpectQuery(`SELECT id, code, title, max_score FROM "criteria"`).WithArgs(uint64(1))
+			if fail {
+				q.WillReturnError(errStep)
+				return
+			}
+			q.WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score"}).
+				AddRow(1, "K1", "Позиция автора", 1).
+				AddRow(2, "K2", "Комментарий", 3))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			q := mock.ExpectQuery(`INSERT INTO result \(sum_score, essay_id, attempt_id, rubric_version_id\)`).
+				WithArgs(3, essayID, attemptID, uint64(1))
+			if fail {
+				q.WillReturnError(errStep)
+				return
+			}
+			q.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			e := mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO result_criteria (result_id, criteria_id, score, explanation)
+		VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`)).
+				WithArgs(5, uint64(1), 1, "ok", 5, uint64(2), 2, "")
+			if fail {
+				e.WillReturnError(errStep)
+				return
+			}
+			e.WillReturnResult(sqlmock.NewResult(0, 2))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			e := mock.ExpectExec(`UPDATE check_attempt`).WithArgs(essayID, attemptID)
+			if fail {
+				e.WillReturnError(errStep)
+				return
+			}
+			e.WillReturnResult(sqlmock.NewResult(0, 1))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			e := mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+				WithArgs(StatusChecked, essayID, StatusSaved)
+			if fail {
+				e.WillReturnError(errStep)
+				return
+			}
+			e.WillReturnResult(sqlmock.NewResult(0, 1))
+		},
+		func(mock sqlmock.Sqlmock, fail bool) {
+			e := mock.ExpectExec(`INSERT INTO essay_status_history`).
+				WithArgs(essayID, StatusSaved, StatusChecked, ActorChecker, uint64(0), "check result "+attemptID)
+			if fail {
+				e.WillReturnError(errStep)
+				return
+			}
+			e.WillReturnResult(sqlmock.NewResult(1, 1))
+		},
+	}
+}
+
+func newCheckResult() *models.CheckResult {
+	return &models.CheckResult{
+		EssayID:   1,
+		AttemptID: "a1",
+		LLMResponse: models.DetailedResult{Criteria: []models.CriterionScore{
+			{Code: "K1", Score: 1, Explanation: "ok"},
+			{Code: "K2", Score: 2},
+		}},
+	}
+}
+
+func TestUserService_SaveCheckResult(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	for _, step := range checkResultSteps(1, "a1") {
+		step(mock, false)
+	}
+	mock.ExpectCommit()
+
+	result := newCheckResult()
+	err := service.SaveCheckResult(result)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, result.LLMResponse.Score) {
+		assert.Equal(t, 3, *result.LLMResponse.Score)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_SaveCheckResult_RollsBackOnEachStep(t *testing.T) {
+	steps := checkResultSteps(1, "a1")
+	for failAt := range steps {
+		db, mock, _ := sqlmock.New()
+
+		service := NewUserService(db)
+
+		mock.ExpectBegin()
+		for i := 0; i <= failAt; i++ {
+			steps[i](mock, i == failAt)
+		}
+		mock.ExpectRollback()
+
+		err := service.SaveCheckResult(newCheckResult())
+
+		assert.ErrorIs(t, err, errStep, "step %d", failAt)
+		assert.NoError(t, mock.ExpectationsWereMet(), "step %d", failAt)
+		db.Close()
+	}
+}
+
+func TestUserService_SaveCheckResult_InvalidResultRollsBack(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	steps := checkResultSteps(1, "a1")
+	mock.ExpectBegin()
+	for _, step := range steps[:4] {
+		step(mock, false)
+	}
+	mock.ExpectRollback()
+
+	result := newCheckResult()
+	result.LLMResponse.Criteria[1].Score = 7
+	err := service.SaveCheckResult(result)
+
+	assert.ErrorIs(t, err, ErrInvalidResult)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"fmt"
+	"strings"
+)
+
+// FieldError describes one rejected field of a result.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found in a result. It matches ErrInvalidResult.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidResult, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidResult
+}
+
+func (e *ValidationError) add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// dependencyRule zeroes dependent criteria when the source criterion got 0 points.
+type dependencyRule struct {
+	If        string
+	Dependent []string
+}
+
+// dependencyRules are scoring rules of rubrics by rubric code.
+var dependencyRules = map[string][]dependencyRule{
+	// ЕГЭ: если по К1 выставлено 0 баллов, то по К2–К4 тоже 0
+	"ege": {
+		{If: "K1", Dependent: []string{"K2", "K3", "K4"}},
+	},
+}
+
+// validateResult matches result entries to criteria by ID or code, fills in their
+// IDs, codes, titles and max scores and checks scores against max_score and the
+// dependency rules of the rubric. Every criterion of the rubric must be scored.
+func validateResult(result *models.DetailedResult, rubricCode string, criteria []models.Criteria) error {
+	byID := make(map[uint64]models.Criteria, len(criteria))
+	byCode := make(map[string]models.Criteria, len(criteria))
+	for _, c := range criteria {
+		byID[c.ID] = c
+		byCode[c.Code] = c
+	}
+
+	verr := &ValidationError{}
+	scores := make(map[string]int, len(result.Criteria))
+	for i := range result.Criteria {
+		entry := &result.Criteria[i]
+		field := fmt.Sprintf("criteria[%d]", i)
+
+		c, ok := byID[entry.CriteriaID]
+		if entry.CriteriaID == 0 {
+			c, ok = byCode[entry.Code]
+		}
+		if !ok {
+			verr.add(field, "unknown criterion %d %q", entry.CriteriaID, entry.Code)
+			continue
+		}
+		field = c.Code
+		if _, ok := scores[c.Code]; ok {
+			verr.add(field, "criterion is repeated")
+			continue
+		}
+		scores[c.Code] = entry.Score
+
+		if entry.Score < 0 || entry.Score > c.MaxScore {
+			verr.add(field, "score %d is out of range 0..%d", entry.Score, c.MaxScore)
+		}
+
+		entry.CriteriaID = c.ID
+		entry.Code = c.Code
+		entry.Title = c.Title
+		entry.MaxScore = c.MaxScore
+	}
+
+	for _, c := range criteria {
+		if _, ok := scores[c.Code]; !ok {
+			verr.add(c.Code, "criterion is missing")
+		}
+	}
+
+	for _, rule := range dependencyRules[rubricCode] {
+		if score, ok := scores[rule.If]; !ok || score != 0 {
+			continue
+		}
+		for _, code := range rule.Dependent {
+			if scores[code] != 0 {
+				verr.add(code, "must be 0 when %s is 0", rule.If)
+			}
+		}
+	}
+
+	if len(verr.Fields) > 0 {
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"essay/src/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResult(t *testing.T) {
+	criteria := []models.Criteria{
+		{ID: 1, Code: "K1", Title: "Позиция автора", MaxScore: 1},
+		{ID: 2, Code: "K2", Title: "Комментарий", MaxScore: 3},
+	}
+
+	tests := []struct {
+		name   string
+		scores []models.CriterionScore
+		fields []string
+	}{
+		{"by code", []models.CriterionScore{{Code: "K1", Score: 1}, {Code: "K2", Score: 3}}, nil},
+		{"by id", []models.CriterionScore{{CriteriaID: 1, Score: 1}, {CriteriaID: 2, Score: 0}}, nil},
+		{"unknown code", []models.CriterionScore{{Code: "K1", Score: 1}, {Code: "K2", Score: 1}, {Code: "K11", Score: 1}}, []string{"criteria[2]"}},
+		{"above max", []models.CriterionScore{{Code: "K1", Score: 7}, {Code: "K2", Score: 1}}, []string{"K1"}},
+		{"negative", []models.CriterionScore{{Code: "K1", Score: 1}, {Code: "K2", Score: -1}}, []string{"K2"}},
+		{"repeated", []models.CriterionScore{{Code: "K1", Score: 1}, {CriteriaID: 1, Score: 0}, {Code: "K2", Score: 1}}, []string{"K1"}},
+		{"missing", []models.CriterionScore{{Code: "K1", Score: 1}}, []string{"K2"}},
+		{"dependency", []models.CriterionScore{{Code: "K1", Score: 0}, {Code: "K2", Score: 2}}, []string{"K2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &models.DetailedResult{Criteria: tt.scores}
+			err := validateResult(result, "ege", criteria)
+			if tt.fields != nil {
+				var verr *ValidationError
+				if assert.True(t, errors.As(err, &verr), err) {
+					var fields []string
+					for _, f := range verr.Fields {
+						fields = append(fields, f.Field)
+					}
+					assert.Equal(t, tt.fields, fields)
+				}
+				assert.True(t, errors.Is(err, ErrInvalidResult))
+				return
+			}
+			assert.NoError(t, err)
+			for _, c := range result.Criteria {
+				assert.NotZero(t, c.CriteriaID)
+				assert.NotEmpty(t, c.Code)
+				assert.NotEmpty(t, c.Title)
+			}
+		})
+	}
+}
+
+func TestValidateResult_RulesAreRubricSpecific(t *testing.T) {
+	criteria := []models.Criteria{
+		{ID: 1, Code: "K1", Title: "Позиция автора", MaxScore: 1},
+		{ID: 2, Code: "K2", Title: "Комментарий", MaxScore: 3},
+	}
+	result := &models.DetailedResult{Criteria: []models.CriterionScore{{Code: "K1", Score: 0}, {Code: "K2", Score: 2}}}
+
+	assert.NoError(t, validateResult(result, "oge", criteria))
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"unicode"
+)
+
+// Diff operations.
+const (
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffCells limits the LCS table. Texts that differ more are reported as one
+// replacement of the changed middle part.
+const maxDiffCells = 1 << 22
+
+// word is a run of non-space characters with its rune offsets in the text.
+type word struct {
+	text       string
+	start, end int
+}
+
+func splitWords(text []rune) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			words = append(words, word{string(text[start:i]), start, i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{string(text[start:]), start, len(text)})
+	}
+	return words
+}
+
+// diffWords compares texts word by word and returns deletions from a and insertions
+// into b in text order. Changes in spacing alone are ignored.
+func diffWords(a, b string) []models.TextChange {
+	ra, rb := []rune(a), []rune(b)
+	wa, wb := splitWords(ra), splitWords(rb)
+
+	// общие начало и конец не участвуют в таблице
+	prefix := 0
+	for prefix < len(wa) && prefix < len(wb) && wa[prefix].text == wb[prefix].text {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(wa)-prefix && suffix < len(wb)-prefix &&
+		wa[len(wa)-1-suffix].text == wb[len(wb)-1-suffix].text {
+		suffix++
+	}
+	wa, wb = wa[prefix:len(wa)-suffix], wb[prefix:len(wb)-suffix]
+
+	changes := []models.TextChange{}
+	span := func(op string, text []rune, words []word) {
+		if len(words) == 0 {
+			return
+		}
+		start, end := words[0].start, words[len(words)-1].end
+		changes = append(changes, models.TextChange{
+			Op: op, Offset: start, Length: end - start, Text: string(text[start:end]),
+		})
+	}
+
+	n, m := len(wa), len(wb)
+	if (n+1)*(m+1) > maxDiffCells {
+		span(DiffDelete, ra, wa)
+		span(DiffInsert, rb, wb)
+		return changes
+	}
+
+	// lcs[i*(m+1)+j] — длина наибольшей общей подпоследовательности wa[i:] и wb[j:]
+	lcs := make([]int32, (n+1)*(m+1))
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if wa[i].text == wb[j].text {
+				lcs[i*(m+1)+j] = lcs[(i+1)*(m+1)+j+1] + 1
+			} else {
+				lcs[i*(m+1)+j] = max(lcs[(i+1)*(m+1)+j], lcs[i*(m+1)+j+1])
+			}
+		}
+	}
+
+	delFrom, insFrom := -1, -1
+	flush := func(i, j int) {
+		if delFrom >= 0 {
+			span(DiffDelete, ra, wa[delFrom:i])
+			delFrom = -1
+		}
+		if insFrom >= 0 {
+			span(DiffInsert, rb, wb[insFrom:j])
+			insFrom = -1
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && wa[i].text == wb[j].text:
+			flush(i, j)
+			i++
+			j++
+		case j == m || (i < n && lcs[(i+1)*(m+1)+j] >= lcs[i*(m+1)+j+1]):
+			if delFrom < 0 {
+				delFrom = i
+			}
+			i++
+		default:
+			if insFrom < 0 {
+				insFrom = j
+			}
+			j++
+		}
+	}
+	flush(n, m)
+
+	return changes
+}
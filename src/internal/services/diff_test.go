@@ -0,0 +1,57 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []models.TextChange
+	}{
+		{
+			name: "same text",
+			a:    "Автор  поднимает проблему",
+			b:    "Автор поднимает\nпроблему",
+			want: []models.TextChange{},
+		},
+		{
+			name: "insertion",
+			a:    "Автор поднимает проблему",
+			b:    "Автор поднимает важную проблему",
+			want: []models.TextChange{{Op: DiffInsert, Offset: 16, Length: 6, Text: "важную"}},
+		},
+		{
+			name: "deletion",
+			a:    "Автор очень явно поднимает проблему",
+			b:    "Автор поднимает проблему",
+			want: []models.TextChange{{Op: DiffDelete, Offset: 6, Length: 10, Text: "очень явно"}},
+		},
+		{
+			name: "replacement",
+			a:    "Я согласен с автором.",
+			b:    "Я не согласен с автором!",
+			want: []models.TextChange{
+				{Op: DiffInsert, Offset: 2, Length: 2, Text: "не"},
+				{Op: DiffDelete, Offset: 13, Length: 8, Text: "автором."},
+				{Op: DiffInsert, Offset: 16, Length: 8, Text: "автором!"},
+			},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "Первый абзац",
+			want: []models.TextChange{{Op: DiffInsert, Offset: 0, Length: 12, Text: "Первый абзац"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, diffWords(tt.a, tt.b))
+		})
+	}
+}
@@ -1,16 +1,26 @@
 package services
 
 import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
 	"essay/src/internal/models"
 	"fmt"
 	"time"
 )
 
+// NewAttemptID returns a random identifier of one check attempt.
+func NewAttemptID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 // GetPublishedEssaysCount retrieves essays count.
 func (s *UserService) GetEssaysCount() (int, error) {
 	var count int
 
-	query := `SELECT COUNT(*) FROM essay WHERE is_published = true`
+	query := `SELECT COUNT(*) FROM essay e WHERE e.is_published = true AND ` + essayVisible
 	err := s.DB.QueryRow(query).Scan(&count)
 
 	if err != nil {
@@ -38,7 +48,7 @@ func (s *UserService) GetPublishedEssays() ([]models.EssayCard, error) {
 			ORDER BY id DESC
 			LIMIT 1
 		) r ON true
-		WHERE e.is_published = true
+		WHERE e.is_published = true AND ` + essayVisible + `
 		GROUP BY e.id, e.variant_id, v.variant_title, u.nickname, r.sum_score
 		`
 	rows, err := s.DB.Query(query)
@@ -62,15 +72,18 @@ func (s *UserService) GetPublishedEssays() ([]models.EssayCard, error) {
 	return essays, nil
 }
 
-// GetPublishedEssays retrieves all appeal essays.
-func (s *UserService) GetAppealEssays() ([]models.EssayCard, error) {
+// GetAppealEssays retrieves essays with an appeal the moderator can work on:
+// filed appeals and appeals claimed by the moderator.
+func (s *UserService) GetAppealEssays(moderatorID uint64) ([]models.EssayCard, error) {
 	query := `
 		SELECT 
 			e.id, e.variant_id, v.variant_title, u.nickname AS author_nickname, 
 			COALESCE(COUNT(l.user_id), 0) AS likes, 
 			COALESCE(r.sum_score, 0) AS score,
-			e.status
+			e.status, a.id
 		FROM essay e
+		JOIN appeal a ON a.essay_id = e.id
+			AND (a.status = 'filed' OR (a.status = 'claimed' AND a.moderator_id = $1))
 		JOIN variant v ON e.variant_id = v.id
 		JOIN "user" u ON e.user_id = u.id
 		LEFT JOIN "like" l ON e.id = l.essay_id
@@ -81,10 +94,11 @@ func (s *UserService) GetAppealEssays() ([]models.EssayCard, error) {
 			ORDER BY id DESC
 			LIMIT 1
 		) r ON true
-		WHERE status = 'appeal'
-		GROUP BY e.id, e.variant_id, v.variant_title, u.nickname, r.sum_score
+		WHERE e.status = 'appeal'
+		GROUP BY e.id, e.variant_id, v.variant_title, u.nickname, r.sum_score, a.id
+		ORDER BY a.id
     `
-	rows, err := s.DB.Query(query)
+	rows, err := s.DB.Query(query, moderatorID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,7 +109,7 @@ func (s *UserService) GetAppealEssays() ([]models.EssayCard, error) {
 		var essayCard models.EssayCard
 		if err := rows.Scan(
 			&essayCard.ID, &essayCard.VariantID, &essayCard.VariantTitle, &essayCard.AuthorNickname,
-			&essayCard.Likes, &essayCard.Score, &essayCard.Status,
+			&essayCard.Likes, &essayCard.Score, &essayCard.Status, &essayCard.AppealID,
 		); err != nil {
 			return nil, err
 		}
@@ -105,13 +119,14 @@ func (s *UserService) GetAppealEssays() ([]models.EssayCard, error) {
 	return essayCards, nil
 }
 
-// GetEssayByID retrieves an essay by its ID.
+// GetEssayByID retrieves an essay by its ID. Removed essays are returned too, with
+// RemovedAt set.
 func (s *UserService) GetEssayByID(id uint64) (*models.Essay, error) {
-	query := `SELECT id, essay_text, completed_at, status, is_published, user_id, variant_id FROM essay WHERE id = $1`
+	query := `SELECT id, essay_text, completed_at, status, is_published, user_id, variant_id, COALESCE(deleted_at, archived_at) FROM essay WHERE id = $1`
 	row := s.DB.QueryRow(query, id)
 
 	var essay models.Essay
-	if err := row.Scan(&essay.ID, &essay.EssayText, &essay.CompletedAt, &essay.Status, &essay.IsPublished, &essay.UserID, &essay.VariantID); err != nil {
+	if err := row.Scan(&essay.ID, &essay.EssayText, &essay.CompletedAt, &essay.Status, &essay.IsPublished, &essay.UserID, &essay.VariantID, &essay.RemovedAt); err != nil {
 		return nil, err
 	}
 
@@ -121,13 +136,15 @@ func (s *UserService) GetEssayByID(id uint64) (*models.Essay, error) {
 // GetDetailedEssayByID retrieves detailed essay by its ID.
 func (s *UserService) GetDetailedEssayByID(id uint64) (*models.DetailedEssay, error) {
 	var essay models.DetailedEssay
-	err := s.DB.QueryRow("SELECT e.id, variant_id, essay_text, completed_at, status, is_published, user_id, nickname FROM essay e JOIN \"user\" u ON e.user_id = u.id WHERE e.id = $1", id).Scan(
+	err := s.DB.QueryRow("SELECT e.id, variant_id, essay_text, completed_at, status, version, is_published, COALESCE(e.deleted_at, e.archived_at), user_id, nickname FROM essay e JOIN \"user\" u ON e.user_id = u.id WHERE e.id = $1", id).Scan(
 		&essay.ID,
 		&essay.VariantID,
 		&essay.EssayText,
 		&essay.CompletedAt,
 		&essay.Status,
+		&essay.Version,
 		&essay.IsPublished,
+		&essay.RemovedAt,
 		&essay.AuthorID,
 		&essay.AuthorNickname,
 	)
@@ -170,96 +187,115 @@ func (s *UserService) GetDetailedEssayByID(id uint64) (*models.DetailedEssay, er
 	}
 	essay.Comments = comments
 
+	results, err := s.getEssayResults(essay.ID)
+	if err != nil {
+		return nil, err
+	}
+	essay.Results = results
+
+	essay.Exam, err = essayExamSession(s.DB, essay.ID)
+	if err != nil {
+		return nil, fmt.Errorf("exam session fetching error: %w", err)
+	}
+
+	return &essay, nil
+}
+
+// getEssayResults returns results of the essay with their criteria in criteria order.
+func (s *UserService) getEssayResults(essayID uint64) ([]models.DetailedResult, error) {
 	query := `
 	SELECT 
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 1 THEN rc.score ELSE 0 END), 0) AS K1_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 2 THEN rc.score ELSE 0 END), 0) AS K2_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 3 THEN rc.score ELSE 0 END), 0) AS K3_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 4 THEN rc.score ELSE 0 END), 0) AS K4_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 5 THEN rc.score ELSE 0 END), 0) AS K5_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 6 THEN rc.score ELSE 0 END), 0) AS K6_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 7 THEN rc.score ELSE 0 END), 0) AS K7_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 8 THEN rc.score ELSE 0 END), 0) AS K8_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 9 THEN rc.score ELSE 0 END), 0) AS K9_score,
-		COALESCE(SUM(CASE WHEN rc.criteria_id = 10 THEN rc.score ELSE 0 END), 0) AS K10_score,
-		SUM(rc.score) AS Score,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 1 THEN rc.explanation ELSE NULL END, ', '), '') AS K1_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 2 THEN rc.explanation ELSE NULL END, ', '), '') AS K2_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 3 THEN rc.explanation ELSE NULL END, ', '), '') AS K3_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 4 THEN rc.explanation ELSE NULL END, ', '), '') AS K4_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 5 THEN rc.explanation ELSE NULL END, ', '), '') AS K5_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 6 THEN rc.explanation ELSE NULL END, ', '), '') AS K6_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 7 THEN rc.explanation ELSE NULL END, ', '), '') AS K7_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 8 THEN rc.explanation ELSE NULL END, ', '), '') AS K8_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 9 THEN rc.explanation ELSE NULL END, ', '), '') AS K9_explanation,
-		COALESCE(STRING_AGG(CASE WHEN rc.criteria_id = 10 THEN rc.explanation ELSE NULL END, ', '), '') AS K10_explanation,
-		r.appeal_text
+		r.id, r.sum_score, r.appeal_text, COALESCE(r.rubric_version_id, 0),
+		c.id, c.code, c.title, c.max_score,
+		rc.score, COALESCE(rc.explanation, '')
 	FROM 
 		result r
 	LEFT JOIN 
 		result_criteria rc ON r.id = rc.result_id
+	LEFT JOIN 
+		criteria c ON c.id = rc.criteria_id
 	WHERE 
 		r.essay_id = $1
-	GROUP BY 
-		r.id;
+	ORDER BY 
+		r.id, c.id;
 	`
 
-	rows, err = s.DB.Query(query, essay.ID)
+	rows, err := s.DB.Query(query, essayID)
 	if err != nil {
 		return nil, fmt.Errorf("error executing query: %w", err)
 	}
 	defer rows.Close()
 
 	var detailedResults []models.DetailedResult
+	var lastResultID uint64
 	for rows.Next() {
-		var result models.DetailedResult
-		err := rows.Scan(
-			&result.K1_score,
-			&result.K2_score,
-			&result.K3_score,
-			&result.K4_score,
-			&result.K5_score,
-			&result.K6_score,
-			&result.K7_score,
-			&result.K8_score,
-			&result.K9_score,
-			&result.K10_score,
-			&result.Score,
-			&result.K1_explanation,
-			&result.K2_explanation,
-			&result.K3_explanation,
-			&result.K4_explanation,
-			&result.K5_explanation,
-			&result.K6_explanation,
-			&result.K7_explanation,
-			&result.K8_explanation,
-			&result.K9_explanation,
-			&result.K10_explanation,
-			&result.AppealText,
+		var (
+			resultID      uint64
+			sumScore      *int
+			appealText    *string
+			rubricVersion uint64
+			criteriaID    sql.NullInt64
+			code          sql.NullString
+			title         sql.NullString
+			maxScore      sql.NullInt64
+			score         sql.NullInt64
+			explain       string
 		)
+		err := rows.Scan(&resultID, &sumScore, &appealText, &rubricVersion, &criteriaID, &code, &title, &maxScore, &score, &explain)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning results: %w", err)
 		}
-		detailedResults = append(detailedResults, result)
+
+		if len(detailedResults) == 0 || resultID != lastResultID {
+			detailedResults = append(detailedResults, models.DetailedResult{
+				Criteria:        []models.CriterionScore{},
+				Score:           sumScore,
+				AppealText:      appealText,
+				RubricVersionID: rubricVersion,
+			})
+			lastResultID = resultID
+		}
+		if !criteriaID.Valid {
+			continue
+		}
+
+		result := &detailedResults[len(detailedResults)-1]
+		result.Criteria = append(result.Criteria, models.CriterionScore{
+			CriteriaID:  uint64(criteriaID.Int64),
+			Code:        code.String,
+			Title:       title.String,
+			MaxScore:    int(maxScore.Int64),
+			Score:       int(score.Int64),
+			Explanation: explain,
+		})
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating results: %w", err)
 	}
 
-	essay.Results = detailedResults
-
-	return &essay, nil
+	return detailedResults, nil
 }
 
-// GetUserEssays retrieves all essays for a specific user.
+// GetUserEssays retrieves all essays for a specific user except removed ones.
 func (s *UserService) GetUserEssays(userID uint64) ([]models.EssayCard, error) {
+	return s.userEssays(userID, essayVisible)
+}
+
+// GetRemovedEssays retrieves deleted and archived essays of the user that can still
+// be restored.
+func (s *UserService) GetRemovedEssays(userID uint64) ([]models.EssayCard, error) {
+	return s.userEssays(userID, `COALESCE(e.deleted_at, e.archived_at) > $2`, time.Now().Add(-s.EssayRetention))
+}
+
+// userEssays lists essays of the user matching filter; args are bound from $2 on.
+func (s *UserService) userEssays(userID uint64, filter string, args ...any) ([]models.EssayCard, error) {
 	query := `
 		SELECT 
 			e.id, e.variant_id, v.variant_title, u.nickname AS author_nickname, 
 			COALESCE(COUNT(l.user_id), 0) AS likes, 
 			COALESCE(r.sum_score, 0) AS score,
-			e.status
+			e.status, COALESCE(e.deleted_at, e.archived_at)
 		FROM essay e
 		JOIN variant v ON e.variant_id = v.id
 		JOIN "user" u ON e.user_id = u.id
@@ -271,10 +307,10 @@ func (s *UserService) GetUserEssays(userID uint64) ([]models.EssayCard, error) {
 			ORDER BY id DESC
 			LIMIT 1
 		) r ON true
-		WHERE e.user_id = $1
+		WHERE e.user_id = $1 AND ` + filter + `
 		GROUP BY e.id, e.variant_id, v.variant_title, u.nickname, r.sum_score
     `
-	rows, err := s.DB.Query(query, userID)
+	rows, err := s.DB.Query(query, append([]any{userID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +321,7 @@ func (s *UserService) GetUserEssays(userID uint64) ([]models.EssayCard, error) {
 		var essayCard models.EssayCard
 		if err := rows.Scan(
 			&essayCard.ID, &essayCard.VariantID, &essayCard.VariantTitle, &essayCard.AuthorNickname,
-			&essayCard.Likes, &essayCard.Score, &essayCard.Status,
+			&essayCard.Likes, &essayCard.Score, &essayCard.Status, &essayCard.RemovedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -297,50 +333,104 @@ func (s *UserService) GetUserEssays(userID uint64) ([]models.EssayCard, error) {
 
 // CreateEssay creates a new essay in draft status and returns the ID of the created essay.
 func (s *UserService) CreateEssay(essay *models.Essay) (int, error) {
-	query := `INSERT INTO essay (essay_text, completed_at, status, is_published, user_id, variant_id) 
-              VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	var id int
-	err := s.DB.QueryRow(query, essay.EssayText, time.Now(), "draft", false, essay.UserID, essay.VariantID).Scan(&id)
+	id, err := createDraft(s.DB, essay)
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// createDraft inserts a draft essay together with its first revision.
+func createDraft(q querier, essay *models.Essay) (uint64, error) {
+	// первая версия текста сразу попадает в историю правок
+	query := `WITH e AS (
+                  INSERT INTO essay (essay_text, completed_at, status, is_published, user_id, variant_id) 
+                  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, essay_text, completed_at
+              )
+              INSERT INTO essay_revision (essay_id, version, essay_text, created_at)
+              SELECT id, 1, essay_text, completed_at FROM e
+              RETURNING essay_id`
+	var id uint64
+	err := q.QueryRow(query, essay.EssayText, time.Now(), "draft", false, essay.UserID, essay.VariantID).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
 	return id, nil
 }
 
-// UpdateEssay updates an existing essay.
-func (s *UserService) UpdateEssay(essay *models.Essay) error {
-	countQuery := `SELECT COUNT(*) FROM essay WHERE id = $1 AND user_id = $2`
-	var count int
+// VersionConflictError reports a stale essay version together with the current text.
+// It matches ErrVersionConflict.
+type VersionConflictError struct {
+	Version   int
+	EssayText string
+}
 
-	err := s.DB.QueryRow(countQuery, essay.ID, essay.UserID).Scan(&count)
-	if err != nil {
-		return err
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v: current version is %d", ErrVersionConflict, e.Version)
+}
+
+func (e *VersionConflictError) Unwrap() error {
+	return ErrVersionConflict
+}
+
+// UpdateEssay replaces the text of the essay if it still has the given version and
+// stores the new text as a revision in the same statement. Returns the new version.
+// Saving the same text again changes nothing and returns the current version. Essays
+// of an exam session cannot be changed after its deadline. Only drafts can be changed:
+// the text of an essay sent for checking must match its result. A removed essay is
+// reported as sql.ErrNoRows.
+func (s *UserService) UpdateEssay(essay *models.Essay, version int) (int, error) {
+	var newVersion int
+	err := s.DB.QueryRow(`
+		WITH e AS (
+			UPDATE essay SET essay_text = $1, version = version + 1
+			WHERE id = $2 AND user_id = $3 AND version = $4 AND essay_text IS DISTINCT FROM $1
+				AND status = 'draft' AND deleted_at IS NULL AND archived_at IS NULL
+				AND NOT EXISTS (SELECT 1 FROM exam_session x WHERE x.essay_id = essay.id AND x.deadline_at <= NOW())
+			RETURNING id, version, essay_text
+		)
+		INSERT INTO essay_revision (essay_id, version, essay_text)
+		SELECT id, version, essay_text FROM e
+		RETURNING version`,
+		essay.EssayText, essay.ID, essay.UserID, version,
+	).Scan(&newVersion)
+	if err == nil {
+		return newVersion, nil
 	}
-	if count > 0 {
-		query := `UPDATE essay SET essay_text = $1 WHERE id = $2 AND user_id = $3`
-		_, err = s.DB.Exec(query, essay.EssayText, essay.ID, essay.UserID)
-		if err != nil {
-			return err
-		}
-		return nil
-	} else {
-		return ErrWrongID
+	if err != sql.ErrNoRows {
+		return 0, err
 	}
-}
 
-// ChangeEssayStatus updates the status of an essay.
-func (s *UserService) ChangeEssayStatus(essayID uint64, status string) error {
-	query := `UPDATE essay SET status = $1 WHERE id = $2`
-	_, err := s.DB.Exec(query, status, essayID)
+	// ничего не обновилось: выясняем почему
+	var current models.Essay
+	var examOver bool
+	err = s.DB.QueryRow(`
+		SELECT user_id, version, COALESCE(essay_text, ''),
+			EXISTS(SELECT 1 FROM exam_session WHERE essay_id = $1 AND deadline_at <= NOW()), status
+		FROM essay WHERE id = $1 AND deleted_at IS NULL AND archived_at IS NULL`, essay.ID).
+		Scan(&current.UserID, &current.Version, &current.EssayText, &examOver, &current.Status)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	if current.UserID != essay.UserID {
+		return 0, ErrWrongID
+	}
+	if examOver {
+		return 0, ErrExamTimeOver
+	}
+	if current.Status != StatusDraft {
+		return 0, ErrWrongStatus
+	}
+	if current.Version != version {
+		return 0, &VersionConflictError{Version: current.Version, EssayText: current.EssayText}
+	}
+
+	return current.Version, nil
 }
 
-// PublishEssay marks an essay as published.
+// PublishEssay marks an essay as published. Removed essays are not published.
 func (s *UserService) PublishEssay(essayID uint64, userID uint64) error {
-	query := `UPDATE essay SET is_published = true WHERE id = $1 AND user_id = $2`
+	query := `UPDATE essay SET is_published = true WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL AND archived_at IS NULL`
 	_, err := s.DB.Exec(query, essayID, userID)
 	if err != nil {
 		return err
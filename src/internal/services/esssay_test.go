@@ -68,7 +68,7 @@ func TestUserService_GetAppealEssays(t *testing.T) {
 	mock.ExpectQuery(`SELECT id, essay_text, updated_at, status, is_published, user_id, variant_id FROM essay WHERE status = 'appeal'`).
 		WillReturnRows(rows)
 
-	essays, err := service.GetAppealEssays()
+	essays, err := service.GetAppealEssays(1)
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedEssays, essays)
@@ -284,9 +284,11 @@ func TestUserService_CreateEssay(t *testing.T) {
 		IsPublished: false,
 	}
 
-	mock.ExpectQuery(`INSERT INTO essay \(essay_text, updated_at, status, is_published, user_id, variant_id\) VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) RETURNING id`).
-		WithArgs(newEssay.EssayText, sqlmock.AnyArg(), "draft", false, newEssay.UserID, newEssay.VariantID).
-		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	// черновик и его первая правка создаются одним запросом
+	mock.ExpectQuery(`INSERT INTO essay \(essay_text, completed_at, status, is_published, user_id, variant_id\)\s+VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\) RETURNING id, essay_text, completed_at\s+\)\s+`+
+		`INSERT INTO essay_revision \(essay_id, version, essay_text, created_at\)\s+SELECT id, 1, essay_text, completed_at FROM e\s+RETURNING essay_id`).
+		WithArgs(newEssay.EssayText, sqlmock.AnyArg(), StatusDraft, false, newEssay.UserID, newEssay.VariantID).
+		WillReturnRows(sqlmock.NewRows([]string{"essay_id"}).AddRow(1))
 
 	id, err := service.CreateEssay(&newEssay)
 
@@ -301,13 +303,18 @@ func TestUserService_ChangeEssayStatus(t *testing.T) {
 
 	service := NewUserService(db)
 	essayID := uint64(1)
-	status := "published"
-
-	mock.ExpectExec(`UPDATE essay SET status = \$1 WHERE id = \$2 AND user_id = \$3`).
-		WithArgs(status, essayID).
+	actor := models.Actor{Kind: ActorUser, UserID: 2}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE essay SET status = \$1 WHERE id = \$2 AND status = \$3`).
+		WithArgs(StatusAppeal, essayID, StatusChecked).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(essayID, StatusChecked, StatusAppeal, ActorUser, uint64(2), "appeal filed").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	err := service.ChangeEssayStatus(essayID, status)
+	err := service.ChangeEssayStatus(essayID, StatusChecked, StatusAppeal, actor, "appeal filed")
 
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -319,20 +326,63 @@ func TestUserService_ChangeEssayStatus_Error(t *testing.T) {
 
 	service := NewUserService(db)
 	essayID := uint64(1)
-	userID := uint64(1)
-	status := "published"
+	actor := models.Actor{Kind: ActorUser, UserID: 2}
 
-	mock.ExpectExec(`UPDATE essay SET status = \$1 WHERE id = \$2 AND user_id = \$3`).
-		WithArgs(status, essayID, userID).
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE essay SET status = \$1 WHERE id = \$2 AND status = \$3`).
+		WithArgs(StatusAppeal, essayID, StatusChecked).
 		WillReturnError(errors.New("update failed"))
+	mock.ExpectRollback()
 
-	err := service.ChangeEssayStatus(essayID, status)
+	err := service.ChangeEssayStatus(essayID, StatusChecked, StatusAppeal, actor, "")
 
 	assert.Error(t, err)
 	assert.EqualError(t, err, "update failed")
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUserService_ChangeEssayStatus_Concurrent(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE essay SET status = \$1 WHERE id = \$2 AND status = \$3`).
+		WithArgs(StatusAppeal, uint64(1), StatusChecked).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err := service.ChangeEssayStatus(1, StatusChecked, StatusAppeal, models.Actor{Kind: ActorUser, UserID: 2}, "")
+
+	assert.ErrorIs(t, err, ErrWrongStatus)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ChangeEssayStatus_NotAllowed(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err := service.ChangeEssayStatus(1, StatusDraft, StatusChecked, models.Actor{Kind: ActorUser, UserID: 2}, "")
+
+	assert.ErrorIs(t, err, ErrWrongStatus)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCanTransition(t *testing.T) {
+	assert.True(t, CanTransition(StatusDraft, StatusSaved))
+	assert.True(t, CanTransition(StatusFailed, StatusSaved))
+	assert.True(t, CanTransition(StatusChecked, StatusAppeal))
+	assert.False(t, CanTransition(StatusChecked, StatusDraft))
+	assert.False(t, CanTransition(StatusAppealed, StatusAppeal))
+	assert.False(t, CanTransition("published", StatusChecked))
+}
+
 func TestUserService_UpdateEssay_Success(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
@@ -344,17 +394,54 @@ func TestUserService_UpdateEssay_Success(t *testing.T) {
 		UserID:    1,
 	}
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM essay WHERE id = \$1 AND user_id = \$2`).
-		WithArgs(updatedEssay.ID, updatedEssay.UserID).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(`UPDATE essay SET essay_text = \$1, version = version \+ 1`).
+		WithArgs(updatedEssay.EssayText, updatedEssay.ID, updatedEssay.UserID, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
 
-	mock.ExpectExec(`UPDATE essay SET essay_text = \$1 WHERE id = \$2 AND user_id = \$3`).
-		WithArgs(updatedEssay.EssayText, updatedEssay.ID, updatedEssay.UserID).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	version, err := service.UpdateEssay(&updatedEssay, 3)
 
-	err := service.UpdateEssay(&updatedEssay)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectCurrentEssay(mock sqlmock.Sqlmock, id, userID uint64, version int, text string) {
+	mock.ExpectQuery(`UPDATE essay SET essay_text`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(userID, version, text, false, "draft"))
+}
+
+func TestUserService_UpdateEssay_SameText(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	expectCurrentEssay(mock, 1, 1, 3, "Updated Text")
+
+	version, err := service.UpdateEssay(&models.Essay{ID: 1, EssayText: "Updated Text", UserID: 1}, 3)
 
 	assert.NoError(t, err)
+	assert.Equal(t, 3, version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_UpdateEssay_Conflict(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	expectCurrentEssay(mock, 1, 1, 5, "Text from another tab")
+
+	_, err := service.UpdateEssay(&models.Essay{ID: 1, EssayText: "Updated Text", UserID: 1}, 3)
+
+	var conflict *VersionConflictError
+	if assert.True(t, errors.As(err, &conflict)) {
+		assert.Equal(t, 5, conflict.Version)
+		assert.Equal(t, "Text from another tab", conflict.EssayText)
+	}
+	assert.True(t, errors.Is(err, ErrVersionConflict))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -368,17 +455,49 @@ func TestUserService_UpdateEssay_WrongID(t *testing.T) {
 		EssayText: "Updated Text",
 		UserID:    1,
 	}
+	expectCurrentEssay(mock, 1, 2, 3, "Someone else's essay")
 
-	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM essay WHERE id = \$1 AND user_id = \$2`).
-		WithArgs(updatedEssay.ID, updatedEssay.UserID).
-		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-
-	err := service.UpdateEssay(&updatedEssay)
+	_, err := service.UpdateEssay(&updatedEssay, 3)
 
 	assert.Error(t, err)
 	assert.Equal(t, ErrWrongID, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestUserService_UpdateEssay_ExamTimeOver(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectQuery(`UPDATE essay SET essay_text`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(1, 3, "Exam text", true, "draft"))
+
+	_, err := service.UpdateEssay(&models.Essay{ID: 1, EssayText: "Late text", UserID: 1}, 3)
+
+	assert.Equal(t, ErrExamTimeOver, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_UpdateEssay_NotDraft(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectQuery(`UPDATE essay SET essay_text[\s\S]+AND status = 'draft'`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(1, 3, "Checked text", false, StatusChecked))
+
+	_, err := service.UpdateEssay(&models.Essay{ID: 1, EssayText: "Rewritten text", UserID: 1}, 3)
+
+	assert.Equal(t, ErrWrongStatus, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserService_PublishEssay(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
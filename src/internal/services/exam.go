@@ -0,0 +1,235 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"essay/src/internal/models"
+	"log"
+	"time"
+)
+
+// Statuses of an exam session.
+const (
+	ExamActive    = "active"
+	ExamSubmitted = "submitted"
+	ExamExpired   = "expired"
+)
+
+// DefaultExamDuration is the time limit of the essay part of the EGE exam.
+const DefaultExamDuration = 210 * time.Minute
+
+const examSessionColumns = `id, user_id, essay_id, variant_id, status, started_at, deadline_at, ended_at`
+
+// StartExamSession picks a variant (a random public one when variantID is 0), creates
+// a draft for it and starts a session that ends s.ExamDuration later. A user can have
+// only one running session and needs a confirmed address and a check left to submit
+// the essay at the end.
+func (s *UserService) StartExamSession(userID, variantID uint64) (*models.ExamSession, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// блокируем пользователя, чтобы две сессии не стартовали одновременно
+	var countChecks int
+	var verified bool
+	err = tx.QueryRow(`SELECT count_checks, email_verified FROM "user" WHERE id = $1 FOR UPDATE`, userID).
+		Scan(&countChecks, &verified)
+	if err != nil {
+		return nil, err
+	}
+	if !verified {
+		return nil, ErrEmailNotVerified
+	}
+	if countChecks <= 0 {
+		return nil, ErrNoChecksLeft
+	}
+
+	var running bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM exam_session WHERE user_id = $1 AND ended_at IS NULL AND deadline_at > NOW())`,
+		userID).Scan(&running)
+	if err != nil {
+		return nil, err
+	}
+	if running {
+		return nil, ErrExamInProgress
+	}
+
+	if variantID == 0 {
+		err = tx.QueryRow(`SELECT id FROM variant WHERE is_public = TRUE ORDER BY random() LIMIT 1`).Scan(&variantID)
+	} else {
+		err = tx.QueryRow(`SELECT id FROM variant WHERE id = $1 AND is_public = TRUE`, variantID).Scan(&variantID)
+	}
+	if err == sql.ErrNoRows {
+		return nil, ErrWrongID
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	essayID, err := createDraft(tx, &models.Essay{UserID: userID, VariantID: variantID})
+	if err != nil {
+		return nil, err
+	}
+
+	startedAt := time.Now()
+	session := &models.ExamSession{
+		UserID:     userID,
+		EssayID:    essayID,
+		VariantID:  variantID,
+		Status:     ExamActive,
+		StartedAt:  startedAt,
+		DeadlineAt: startedAt.Add(s.ExamDuration),
+	}
+	err = tx.QueryRow(`
+		INSERT INTO exam_session (user_id, essay_id, variant_id, status, started_at, deadline_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		userID, essayID, variantID, ExamActive, session.StartedAt, session.DeadlineAt).Scan(&session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetExamSession returns the session with the text autosaved during it.
+func (s *UserService) GetExamSession(id uint64) (*models.ExamSession, error) {
+	session, err := scanExamSession(s.DB.QueryRow(`SELECT `+examSessionColumns+` FROM exam_session WHERE id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	// снимки — версии текста, сохранённые автосохранением до конца сессии
+	rows, err := s.DB.Query(`
+		SELECT version, essay_text, created_at FROM essay_revision
+		WHERE essay_id = $1 AND created_at <= $2
+		ORDER BY version`, session.EssayID, session.DeadlineAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var snapshot models.ExamSnapshot
+		if err := rows.Scan(&snapshot.Version, &snapshot.EssayText, &snapshot.CreatedAt); err != nil {
+			return nil, err
+		}
+		session.Snapshots = append(session.Snapshots, snapshot)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetExamSessions returns the sessions of the user, newest first.
+func (s *UserService) GetExamSessions(userID uint64) ([]models.ExamSession, error) {
+	rows, err := s.DB.Query(`SELECT `+examSessionColumns+` FROM exam_session WHERE user_id = $1 ORDER BY started_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.ExamSession{}
+	for rows.Next() {
+		session, err := scanExamSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// essayExamSession returns the session the essay was written in or nil.
+func essayExamSession(q querier, essayID uint64) (*models.ExamSession, error) {
+	session, err := scanExamSession(q.QueryRow(`SELECT `+examSessionColumns+` FROM exam_session WHERE essay_id = $1`, essayID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return session, err
+}
+
+func scanExamSession(row interface{ Scan(...any) error }) (*models.ExamSession, error) {
+	var session models.ExamSession
+	err := row.Scan(&session.ID, &session.UserID, &session.EssayID, &session.VariantID, &session.Status,
+		&session.StartedAt, &session.DeadlineAt, &session.EndedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CloseExpiredExamSessions ends up to limit sessions whose deadline has passed. The
+// draft of each session is submitted for check; if that is impossible (the essay was
+// deleted or the user has no checks left) the session is marked expired. A session
+// that fails for another reason is logged and left for the next run, so it does not
+// hold up the rest. Returns how many sessions were closed.
+func (s *UserService) CloseExpiredExamSessions(limit int) (int, error) {
+	rows, err := s.DB.Query(`
+		SELECT x.id, e.id, e.user_id, e.variant_id, COALESCE(e.essay_text, ''), e.status, e.deleted_at IS NOT NULL
+		FROM exam_session x
+		JOIN essay e ON e.id = x.essay_id
+		WHERE x.ended_at IS NULL AND x.deadline_at <= NOW()
+		ORDER BY x.deadline_at
+		LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	type expired struct {
+		sessionID uint64
+		essay     models.Essay
+		deleted   bool
+	}
+	var sessions []expired
+	for rows.Next() {
+		var x expired
+		if err := rows.Scan(&x.sessionID, &x.essay.ID, &x.essay.UserID, &x.essay.VariantID, &x.essay.EssayText,
+			&x.essay.Status, &x.deleted); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		sessions = append(sessions, x)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	closed := 0
+	for _, x := range sessions {
+		if x.essay.Status == StatusDraft && !x.deleted {
+			_, err := s.submitEssay(&x.essay, models.Actor{Kind: ActorSystem}, "exam time is over")
+			if err == nil {
+				log.Printf("Exam session %d: essay %d submitted at the deadline", x.sessionID, x.essay.ID)
+				closed++
+				continue
+			}
+			if !errors.Is(err, ErrNoChecksLeft) && !errors.Is(err, ErrWrongStatus) {
+				log.Printf("Exam session %d: failed to submit essay %d: %v", x.sessionID, x.essay.ID, err)
+				continue
+			}
+		}
+
+		_, err := s.DB.Exec(`UPDATE exam_session SET status = $2, ended_at = NOW() WHERE id = $1 AND ended_at IS NULL`,
+			x.sessionID, ExamExpired)
+		if err != nil {
+			log.Printf("Exam session %d: failed to expire: %v", x.sessionID, err)
+			continue
+		}
+		log.Printf("Exam session %d expired", x.sessionID)
+		closed++
+	}
+
+	return closed, nil
+}
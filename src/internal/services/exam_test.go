@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_StartExamSession_RandomVariant(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.ExamDuration = time.Hour
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count_checks, email_verified FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count_checks", "email_verified"}).AddRow(2, true))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM exam_session WHERE user_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM variant WHERE is_public = TRUE ORDER BY random() LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(`INSERT INTO essay`).
+		WithArgs("", sqlmock.AnyArg(), StatusDraft, false, uint64(1), uint64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"essay_id"}).AddRow(9))
+	mock.ExpectQuery(`INSERT INTO exam_session`).
+		WithArgs(uint64(1), uint64(9), uint64(4), ExamActive, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+
+	session, err := service.StartExamSession(1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), session.ID)
+	assert.Equal(t, uint64(9), session.EssayID)
+	assert.Equal(t, uint64(4), session.VariantID)
+	assert.Equal(t, time.Hour, session.DeadlineAt.Sub(session.StartedAt))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_StartExamSession_PrivateVariant(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count_checks, email_verified FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count_checks", "email_verified"}).AddRow(2, true))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM exam_session WHERE user_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM variant WHERE id = $1 AND is_public = TRUE`)).
+		WithArgs(uint64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+
+	_, err := service.StartExamSession(1, 5)
+	assert.Equal(t, ErrWrongID, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_StartExamSession_InProgress(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count_checks, email_verified FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count_checks", "email_verified"}).AddRow(2, true))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM exam_session WHERE user_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	_, err := service.StartExamSession(1, 4)
+	assert.Equal(t, ErrExamInProgress, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_CloseExpiredExamSessions(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`SELECT x.id, e.id, e.user_id, e.variant_id`).
+		WithArgs(100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_id", "user_id", "variant_id", "essay_text", "status", "deleted"}).
+			AddRow(1, 7, 2, 4, passingEssayText, StatusDraft, false).
+			AddRow(2, 8, 2, 4, "", StatusDraft, true))
+
+	// черновик первой сессии отправляется на проверку от имени системы
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, 4)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`)).
+		WithArgs(uint64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusSaved, uint64(7), StatusDraft).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(uint64(7), StatusDraft, StatusSaved, ActorSystem, uint64(0), "exam time is over").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE exam_session SET status`).
+		WithArgs(uint64(7), ExamSubmitted).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_text, COALESCE(author_position, '') FROM variant WHERE id = $1`)).
+		WithArgs(uint64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text", "author_position"}).AddRow("Variant text", "Position"))
+	mock.ExpectExec(`INSERT INTO check_attempt`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO outbox`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// удалённый черновик второй сессии не отправляется
+	mock.ExpectExec(`UPDATE exam_session SET status = \$2, ended_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(uint64(2), ExamExpired).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	closed, err := service.CloseExpiredExamSessions(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, closed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_CloseExpiredExamSessions_SkipsFailed(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`SELECT x.id, e.id, e.user_id, e.variant_id`).
+		WithArgs(100).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_id", "user_id", "variant_id", "essay_text", "status", "deleted"}).
+			AddRow(1, 7, 2, 4, passingEssayText, StatusDraft, false).
+			AddRow(2, 8, 2, 4, "", StatusDraft, true))
+
+	// сбой отправки первой сессии не мешает закрыть следующую
+	mock.ExpectBegin().WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec(`UPDATE exam_session SET status = \$2, ended_at = NOW\(\) WHERE id = \$1`).
+		WithArgs(uint64(2), ExamExpired).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	closed, err := service.CloseExpiredExamSessions(100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
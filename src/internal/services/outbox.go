@@ -0,0 +1,215 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"essay/src/internal/models"
+	"log"
+	"sort"
+	"time"
+)
+
+const maxOutboxBackoff = 10 * time.Minute
+
+// OutboxRules control delivery of outbox rows to the checker.
+type OutboxRules struct {
+	Lease       time.Duration // на сколько relay забирает строки для отправки
+	MaxAttempts int           // после стольких неудач строка становится dead letter
+}
+
+// DefaultOutboxRules are used until the application sets its own.
+var DefaultOutboxRules = OutboxRules{
+	Lease:       5 * time.Minute,
+	MaxAttempts: 10,
+}
+
+// SubmitEssayForCheck charges a check, moves the essay from its current status (draft or
+// failed) to saved and queues it for the checker in one transaction. An essay that
+// fails the pre-check is not charged: it gets zero for all criteria and is checked
+// right away. Only users with a confirmed address can submit. Returns the pre-check
+// of the essay.
+func (s *UserService) SubmitEssayForCheck(essay *models.Essay) (models.Precheck, error) {
+	if err := requireVerifiedEmail(s.DB, essay.UserID); err != nil {
+		return models.Precheck{}, err
+	}
+	return s.submitEssay(essay, models.Actor{Kind: ActorUser, UserID: essay.UserID}, "submitted for check")
+}
+
+// submitEssay is SubmitEssayForCheck on behalf of actor. It also ends the exam
+// session the essay is written in.
+func (s *UserService) submitEssay(essay *models.Essay, actor models.Actor, reason string) (models.Precheck, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.Precheck{}, err
+	}
+	defer tx.Rollback()
+
+	variantText, err := precheckVariantText(tx, essay.VariantID)
+	if err != nil {
+		return models.Precheck{}, err
+	}
+	check := PrecheckEssay(essay.EssayText, variantText)
+
+	// проверка списывается, только если сочинение уйдёт к сервису проверки
+	if check.Passed {
+		res, err := tx.Exec(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`, essay.UserID)
+		if err != nil {
+			return check, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return check, err
+		} else if n == 0 {
+			return check, ErrNoChecksLeft
+		}
+	}
+
+	err = changeStatus(tx, essay.ID, essay.Status, StatusSaved, actor, reason)
+	if err != nil {
+		return check, err
+	}
+
+	_, err = tx.Exec(`UPDATE exam_session SET status = $2, ended_at = NOW() WHERE essay_id = $1 AND ended_at IS NULL`,
+		essay.ID, ExamSubmitted)
+	if err != nil {
+		return check, err
+	}
+
+	if check.Passed {
+		err = enqueueCheck(tx, essay, 1)
+	} else {
+		err = insertPrecheckResult(tx, essay.ID, check)
+		if err == nil {
+			err = changeStatus(tx, essay.ID, StatusSaved, StatusChecked, models.Actor{Kind: ActorSystem}, "precheck failed")
+		}
+	}
+	if err != nil {
+		return check, err
+	}
+
+	return check, tx.Commit()
+}
+
+// enqueueCheck records a new check attempt and puts the essay into the outbox.
+func enqueueCheck(tx *sql.Tx, essay *models.Essay, attemptNumber int) error {
+	request := models.EssayRequest{
+		EssayID:   essay.ID,
+		AttemptID: NewAttemptID(),
+		EssayText: essay.EssayText,
+	}
+	err := tx.QueryRow(`SELECT variant_text, COALESCE(author_position, '') FROM variant WHERE id = $1`, essay.VariantID).
+		Scan(&request.VariantText, &request.AuthorPosition)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO check_attempt (essay_id, attempt_id, attempt_number) VALUES ($1, $2, $3)`,
+		essay.ID, request.AttemptID, attemptNumber)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO outbox (essay_id, payload) VALUES ($1, $2)`, essay.ID, payload)
+	return err
+}
+
+// RelayOutbox delivers up to limit pending outbox rows. The rows are first claimed
+// for s.OutboxRules.Lease, so delivery runs outside any transaction and other relays
+// skip them meanwhile; rows left when the lease runs out are claimed again later.
+// Rows that fail are retried with exponential backoff, and after
+// s.OutboxRules.MaxAttempts failures they become dead letters. Returns the number
+// of delivered rows.
+func (s *UserService) RelayOutbox(limit int, deliver func(request models.EssayRequest) error) (int, error) {
+	leaseEnd := time.Now().Add(s.OutboxRules.Lease)
+	rows, err := s.DB.Query(`
+		UPDATE outbox SET locked_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+				AND (locked_until IS NULL OR locked_until < NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, payload, attempts`, limit, leaseEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	type outboxRow struct {
+		id       uint64
+		payload  []byte
+		attempts int
+	}
+	var claimed []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.payload, &row.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		claimed = append(claimed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].id < claimed[j].id })
+
+	delivered := 0
+	for _, row := range claimed {
+		// аренда кончилась: оставшиеся строки может забрать другой relay
+		if time.Now().After(leaseEnd) {
+			break
+		}
+
+		var request models.EssayRequest
+		deliverErr := json.Unmarshal(row.payload, &request)
+		if deliverErr == nil {
+			deliverErr = deliver(request)
+		}
+
+		if deliverErr == nil {
+			_, err := s.DB.Exec(`
+				UPDATE outbox SET status = 'sent', attempts = attempts + 1, sent_at = NOW(), last_error = NULL, locked_until = NULL
+				WHERE id = $1`, row.id)
+			if err != nil {
+				return delivered, err
+			}
+			delivered++
+			continue
+		}
+
+		attempts := row.attempts + 1
+		if attempts >= s.OutboxRules.MaxAttempts {
+			log.Printf("Outbox row %d failed %d times, moved to dead letters: %v", row.id, attempts, deliverErr)
+			_, err = s.DB.Exec(`
+				UPDATE outbox SET status = 'dead', attempts = attempts + 1, last_error = $1, locked_until = NULL
+				WHERE id = $2`, deliverErr.Error(), row.id)
+		} else {
+			log.Printf("Failed to deliver outbox row %d (attempt %d): %v", row.id, attempts, deliverErr)
+			_, err = s.DB.Exec(`
+				UPDATE outbox SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2, locked_until = NULL
+				WHERE id = $3`, deliverErr.Error(), time.Now().Add(outboxBackoff(attempts)), row.id)
+		}
+		if err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// outboxBackoff returns delay before the next delivery after attempts failures.
+func outboxBackoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts && delay < maxOutboxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxOutboxBackoff)
+}
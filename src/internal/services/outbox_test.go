@@ -0,0 +1,178 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"essay/src/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectVerifiedEmail(mock sqlmock.Sqlmock, userID uint64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email_verified FROM "user" WHERE id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email_verified"}).AddRow(true))
+}
+
+func TestUserService_SubmitEssayForCheck(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	essay := &models.Essay{ID: 7, EssayText: passingEssayText, Status: StatusDraft, UserID: 1, VariantID: 2}
+
+	expectVerifiedEmail(mock, essay.UserID)
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, essay.VariantID)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`)).
+		WithArgs(essay.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusSaved, essay.ID, StatusDraft).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(essay.ID, StatusDraft, StatusSaved, ActorUser, essay.UserID, "submitted for check").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE exam_session SET status`).
+		WithArgs(essay.ID, ExamSubmitted).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_text, COALESCE(author_position, '') FROM variant WHERE id = $1`)).
+		WithArgs(essay.VariantID).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text", "author_position"}).AddRow("variant", "position"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO check_attempt (essay_id, attempt_id, attempt_number) VALUES ($1, $2, $3)`)).
+		WithArgs(essay.ID, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO outbox (essay_id, payload) VALUES ($1, $2)`)).
+		WithArgs(essay.ID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	check, err := service.SubmitEssayForCheck(essay)
+
+	assert.NoError(t, err)
+	assert.True(t, check.Passed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_SubmitEssayForCheck_WrongStatus(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	essay := &models.Essay{ID: 7, EssayText: passingEssayText, Status: StatusDraft, UserID: 1, VariantID: 2}
+
+	expectVerifiedEmail(mock, essay.UserID)
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, essay.VariantID)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`)).
+		WithArgs(essay.UserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusSaved, essay.ID, StatusDraft).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err := service.SubmitEssayForCheck(essay)
+
+	assert.Equal(t, ErrWrongStatus, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectOutboxClaim(mock sqlmock.Sqlmock, limit int, rows *sqlmock.Rows) {
+	mock.ExpectQuery(`UPDATE outbox SET locked_until = \$2\s+WHERE id IN \(`).
+		WithArgs(limit, sqlmock.AnyArg()).
+		WillReturnRows(rows)
+}
+
+func TestUserService_RelayOutbox(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	sent, _ := json.Marshal(models.EssayRequest{EssayID: 1, AttemptID: "a1"})
+	failed, _ := json.Marshal(models.EssayRequest{EssayID: 2, AttemptID: "a2"})
+
+	// строки забираются одним запросом, отправка идёт вне транзакции
+	expectOutboxClaim(mock, 10, sqlmock.NewRows([]string{"id", "payload", "attempts"}).
+		AddRow(2, failed, 2).
+		AddRow(1, sent, 0))
+	mock.ExpectExec(`UPDATE outbox SET status = 'sent', attempts = attempts \+ 1, sent_at = NOW\(\)`).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`UPDATE outbox SET attempts = attempts \+ 1, last_error = \$1, next_attempt_at = \$2, locked_until = NULL`).
+		WithArgs("checker is down", sqlmock.AnyArg(), uint64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	var delivered []models.EssayRequest
+	count, err := service.RelayOutbox(10, func(request models.EssayRequest) error {
+		if request.EssayID == 2 {
+			return errors.New("checker is down")
+		}
+		delivered = append(delivered, request)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []models.EssayRequest{{EssayID: 1, AttemptID: "a1"}}, delivered)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RelayOutbox_DeadLetter(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.OutboxRules = OutboxRules{Lease: time.Minute, MaxAttempts: 3}
+	payload, _ := json.Marshal(models.EssayRequest{EssayID: 1, AttemptID: "a1"})
+
+	expectOutboxClaim(mock, 10, sqlmock.NewRows([]string{"id", "payload", "attempts"}).AddRow(1, payload, 2))
+	mock.ExpectExec(`UPDATE outbox SET status = 'dead', attempts = attempts \+ 1, last_error = \$1, locked_until = NULL`).
+		WithArgs("checker is down", uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	count, err := service.RelayOutbox(10, func(models.EssayRequest) error {
+		return errors.New("checker is down")
+	})
+
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RelayOutbox_LeaseOver(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	service.OutboxRules = OutboxRules{Lease: 10 * time.Millisecond, MaxAttempts: 3}
+	first, _ := json.Marshal(models.EssayRequest{EssayID: 1, AttemptID: "a1"})
+	second, _ := json.Marshal(models.EssayRequest{EssayID: 2, AttemptID: "a2"})
+
+	expectOutboxClaim(mock, 10, sqlmock.NewRows([]string{"id", "payload", "attempts"}).
+		AddRow(1, first, 0).
+		AddRow(2, second, 0))
+	mock.ExpectExec(`UPDATE outbox SET status = 'sent'`).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// первая отправка съела всю аренду: вторую строку заберёт следующий проход
+	count, err := service.RelayOutbox(10, func(models.EssayRequest) error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, outboxBackoff(1))
+	assert.Equal(t, 4*time.Second, outboxBackoff(3))
+	assert.Equal(t, maxOutboxBackoff, outboxBackoff(30))
+}
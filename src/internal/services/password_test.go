@@ -0,0 +1,83 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashPassword(t *testing.T) {
+	first, err := hashPassword("1234")
+	assert.NoError(t, err)
+	second, err := hashPassword("1234")
+	assert.NoError(t, err)
+
+	// одинаковые пароли дают разные хеши благодаря соли
+	assert.NotEqual(t, first, second)
+	assert.True(t, strings.HasPrefix(first, "$argon2id$v=19$m=65536,t=3,p=2$"))
+
+	ok, needsRehash, err := verifyPassword("1234", first)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _, err = verifyPassword("12345", first)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyPassword_OutdatedParams(t *testing.T) {
+	passwordParams = PasswordParams{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := hashPassword("1234")
+	passwordParams = DefaultPasswordParams
+	assert.NoError(t, err)
+
+	ok, needsRehash, err := verifyPassword("1234", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, needsRehash)
+}
+
+func TestVerifyPassword_InvalidHash(t *testing.T) {
+	_, _, err := verifyPassword("1234", "$argon2id$v=19$m=65536$salt")
+	assert.Equal(t, errInvalidPasswordHash, err)
+}
+
+func TestAuthenticate_RehashesLegacyPassword(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	legacy := legacyPasswordHash("1234")
+	assert.Equal(t, "03ac674216f3e15c761ee1a5e255f067953623c8b388b4459e13f978d7c846f4", legacy)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
+		WithArgs("user1@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator", "is_admin"}).AddRow(1, legacy, false, false))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET "password" = $1 WHERE id = $2 AND "password" = $3`)).
+		WithArgs(sqlmock.AnyArg(), uint64(1), legacy).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	user, err := service.Authenticate("user1@example.com", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), user.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthenticate_LegacyPasswordWrong(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
+		WithArgs("user1@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator", "is_admin"}).AddRow(1, legacyPasswordHash("1234"), false, false))
+
+	// без верного пароля хеш не меняется
+	_, err := service.Authenticate("user1@example.com", "4321")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
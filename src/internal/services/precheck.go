@@ -0,0 +1,207 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Thresholds of the pre-check. An essay under MinEssayWords words of its own gets
+// zero for all criteria by the EGE rules; words copied from the source text are not
+// counted.
+const (
+	MinEssayWords     = 150
+	warnEssayWords    = 170
+	minParagraphs     = 3
+	copyShingle       = 5 // столько слов подряд из текста варианта считаются списанными
+	failCopiedShare   = 0.7
+	warnCopiedShare   = 0.3
+	failCyrillicShare = 0.5
+	warnCyrillicShare = 0.9
+)
+
+// Codes of pre-check issues.
+const (
+	PrecheckTooShort      = "too_short"
+	PrecheckFewWords      = "few_words"
+	PrecheckFewParagraphs = "few_paragraphs"
+	PrecheckCopied        = "copied_from_variant"
+	PrecheckNotCyrillic   = "not_cyrillic"
+)
+
+// PrecheckEssay counts words and paragraphs of the essay, finds text copied from the
+// variant and measures the share of Cyrillic letters. Errors mean the essay gets zero
+// without a check, warnings are shown to the user before submission.
+func PrecheckEssay(essayText, variantText string) models.Precheck {
+	words := normalizedWords(essayText)
+	copied := copiedWords(words, normalizedWords(variantText))
+
+	check := models.Precheck{
+		Words:         len(words),
+		OriginalWords: len(words) - copied,
+		Paragraphs:    CountParagraphs(essayText),
+		CyrillicShare: cyrillicShare(essayText),
+	}
+	if len(words) > 0 {
+		check.CopiedShare = float64(copied) / float64(len(words))
+	}
+
+	switch {
+	case check.OriginalWords < MinEssayWords:
+		check.Errors = append(check.Errors, models.PrecheckIssue{Code: PrecheckTooShort,
+			Message: fmt.Sprintf("в сочинении %d собственных слов, нужно не меньше %d", check.OriginalWords, MinEssayWords)})
+	case check.OriginalWords < warnEssayWords:
+		check.Warnings = append(check.Warnings, models.PrecheckIssue{Code: PrecheckFewWords,
+			Message: fmt.Sprintf("в сочинении %d собственных слов, минимум — %d", check.OriginalWords, MinEssayWords)})
+	}
+
+	switch {
+	case check.CopiedShare >= failCopiedShare:
+		check.Errors = append(check.Errors, models.PrecheckIssue{Code: PrecheckCopied,
+			Message: "сочинение почти целиком переписано из исходного текста"})
+	case check.CopiedShare >= warnCopiedShare:
+		check.Warnings = append(check.Warnings, models.PrecheckIssue{Code: PrecheckCopied,
+			Message: fmt.Sprintf("%.0f%% текста совпадает с исходным текстом", check.CopiedShare*100)})
+	}
+
+	switch {
+	case check.CyrillicShare < failCyrillicShare:
+		check.Errors = append(check.Errors, models.PrecheckIssue{Code: PrecheckNotCyrillic,
+			Message: "сочинение написано не на русском языке"})
+	case check.CyrillicShare < warnCyrillicShare:
+		check.Warnings = append(check.Warnings, models.PrecheckIssue{Code: PrecheckNotCyrillic,
+			Message: fmt.Sprintf("только %.0f%% букв кириллические", check.CyrillicShare*100)})
+	}
+
+	if check.Paragraphs < minParagraphs {
+		check.Warnings = append(check.Warnings, models.PrecheckIssue{Code: PrecheckFewParagraphs,
+			Message: fmt.Sprintf("в сочинении %d абзац(ев), обычно их не меньше %d", check.Paragraphs, minParagraphs)})
+	}
+
+	check.Passed = len(check.Errors) == 0
+	return check
+}
+
+// PrecheckUserEssay runs the pre-check on the saved text of the essay.
+func (s *UserService) PrecheckUserEssay(essay *models.Essay) (models.Precheck, error) {
+	variantText, err := precheckVariantText(s.DB, essay.VariantID)
+	if err != nil {
+		return models.Precheck{}, err
+	}
+	return PrecheckEssay(essay.EssayText, variantText), nil
+}
+
+func precheckVariantText(q querier, variantID uint64) (string, error) {
+	var text string
+	err := q.QueryRow(`SELECT COALESCE(variant_text, '') FROM variant WHERE id = $1`, variantID).Scan(&text)
+	return text, err
+}
+
+// insertPrecheckResult stores zero for every criterion of the essay rubric with the
+// pre-check errors as the explanation.
+func insertPrecheckResult(tx *sql.Tx, essayID uint64, check models.Precheck) error {
+	rubricVersionID, _, err := essayRubricVersion(tx, essayID)
+	if err != nil {
+		return err
+	}
+	criteria, err := getCriteria(tx, rubricVersionID)
+	if err != nil {
+		return err
+	}
+
+	messages := make([]string, 0, len(check.Errors))
+	for _, issue := range check.Errors {
+		messages = append(messages, issue.Message)
+	}
+	explanation := "Сочинение не прошло предварительную проверку: " + strings.Join(messages, "; ") + "."
+
+	result := models.DetailedResult{Criteria: make([]models.CriterionScore, 0, len(criteria))}
+	for _, c := range criteria {
+		result.Criteria = append(result.Criteria, models.CriterionScore{CriteriaID: c.ID, Explanation: explanation})
+	}
+
+	_, err = insertResult(tx, &result, essayID, "", rubricVersionID)
+	return err
+}
+
+// normalizedWords returns the words of text in lower case without punctuation.
+func normalizedWords(text string) []string {
+	var words []string
+	for _, w := range splitWords([]rune(text)) {
+		normalized := strings.Map(func(r rune) rune {
+			switch {
+			case r == 'ё' || r == 'Ё':
+				return 'е'
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, w.text)
+		if normalized != "" {
+			words = append(words, normalized)
+		}
+	}
+	return words
+}
+
+// copiedWords counts words of the essay that belong to a run of copyShingle or more
+// words found in the source text.
+func copiedWords(words, source []string) int {
+	if len(words) < copyShingle || len(source) < copyShingle {
+		return 0
+	}
+
+	shingles := make(map[string]struct{}, len(source))
+	for i := 0; i+copyShingle <= len(source); i++ {
+		shingles[strings.Join(source[i:i+copyShingle], " ")] = struct{}{}
+	}
+
+	copied := make([]bool, len(words))
+	for i := 0; i+copyShingle <= len(words); i++ {
+		if _, ok := shingles[strings.Join(words[i:i+copyShingle], " ")]; ok {
+			for j := i; j < i+copyShingle; j++ {
+				copied[j] = true
+			}
+		}
+	}
+
+	count := 0
+	for _, c := range copied {
+		if c {
+			count++
+		}
+	}
+	return count
+}
+
+// CountParagraphs counts non-empty lines of text.
+func CountParagraphs(text string) int {
+	count := 0
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// cyrillicShare returns the share of Cyrillic letters among all letters of text. Text
+// without letters is not reported: it fails as too short.
+func cyrillicShare(text string) float64 {
+	letters, cyrillic := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Cyrillic, r) {
+			cyrillic++
+		}
+	}
+	if letters == 0 {
+		return 1
+	}
+	return float64(cyrillic) / float64(letters)
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// passingEssayText passes the precheck: 240 Cyrillic words in four paragraphs.
+var passingEssayText = strings.TrimSuffix(strings.Repeat(strings.Repeat("Книги учат нас думать и сопереживать. ", 10)+"\n", 4), "\n")
+
+const precheckVariant = "Старый мастер долго смотрел на море и думал о том, что время уходит безвозвратно."
+
+func expectPrecheckVariant(mock sqlmock.Sqlmock, variantID uint64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(variant_text, '') FROM variant WHERE id = $1`)).
+		WithArgs(variantID).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text"}).AddRow(precheckVariant))
+}
+
+func issueCodes(issues []models.PrecheckIssue) []string {
+	codes := []string{}
+	for _, issue := range issues {
+		codes = append(codes, issue.Code)
+	}
+	return codes
+}
+
+func TestPrecheckEssay(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		errors   []string
+		warnings []string
+	}{
+		{"passing", passingEssayText, []string{}, []string{}},
+		{"empty", "", []string{PrecheckTooShort}, []string{PrecheckFewParagraphs}},
+		{"short", strings.Repeat("Книги учат нас думать. ", 30), []string{PrecheckTooShort}, []string{PrecheckFewParagraphs}},
+		{"borderline", strings.Repeat("Книги учат нас думать и сопереживать.\n", 27), []string{}, []string{PrecheckFewWords}},
+		{"copied", strings.Repeat(precheckVariant+"\n", 20), []string{PrecheckTooShort, PrecheckCopied}, []string{}},
+		{"latin", strings.Repeat("Books teach us to think and feel.\n", 40), []string{PrecheckNotCyrillic}, []string{}},
+		{"mixed", passingEssayText + "\n" + strings.Repeat("Books teach us to think. ", 10), []string{}, []string{PrecheckNotCyrillic}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := PrecheckEssay(tt.text, precheckVariant)
+			assert.Equal(t, tt.errors, issueCodes(check.Errors))
+			assert.Equal(t, tt.warnings, issueCodes(check.Warnings))
+			assert.Equal(t, len(tt.errors) == 0, check.Passed)
+		})
+	}
+}
+
+func TestPrecheckEssay_CopiedWordsNotCounted(t *testing.T) {
+	text := passingEssayText + "\n" + precheckVariant
+
+	check := PrecheckEssay(text, precheckVariant)
+
+	assert.Equal(t, 254, check.Words)
+	assert.Equal(t, 240, check.OriginalWords)
+	assert.Equal(t, 5, check.Paragraphs)
+}
+
+func TestUserService_SubmitEssayForCheck_PrecheckFailed(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	essay := &models.Essay{ID: 7, EssayText: "Слишком коротко.", Status: StatusDraft, UserID: 1, VariantID: 2}
+
+	// проверка не списывается, сочинение сразу получает 0 баллов
+	expectVerifiedEmail(mock, essay.UserID)
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, essay.VariantID)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusSaved, essay.ID, StatusDraft).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE exam_session SET status`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT rv.id, r.code`).
+		WithArgs(essay.ID, DefaultRubricCode).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ege"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, code, title, max_score FROM "criteria" WHERE rubric_version_id = $1`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score"}).
+			AddRow(1, "K1", "Позиция", 1).
+			AddRow(2, "K2", "Комментарий", 3))
+	mock.ExpectQuery(`INSERT INTO result`).
+		WithArgs(0, essay.ID, "", uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec(`INSERT INTO result_criteria`).
+		WithArgs(uint64(5), uint64(1), 0, sqlmock.AnyArg(), uint64(5), uint64(2), 0, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusChecked, essay.ID, StatusSaved).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(essay.ID, StatusSaved, StatusChecked, ActorSystem, uint64(0), "precheck failed").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	check, err := service.SubmitEssayForCheck(essay)
+
+	assert.NoError(t, err)
+	assert.False(t, check.Passed)
+	assert.Equal(t, []string{PrecheckTooShort}, issueCodes(check.Errors))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Results of RemoveEssay.
+const (
+	EssayDeleted  = "deleted"
+	EssayArchived = "archived"
+)
+
+// DefaultEssayRetention is how long a removed essay can be restored before it is purged.
+const DefaultEssayRetention = 30 * 24 * time.Hour
+
+// essayVisible filters out deleted and archived essays aliased as e.
+const essayVisible = `e.deleted_at IS NULL AND e.archived_at IS NULL`
+
+// removalColumns tells which column RemoveEssay sets for an essay status. Drafts and
+// failed essays have no result and are deleted, checked essays are archived. Essays
+// that are being checked or appealed cannot be removed.
+var removalColumns = map[string]string{
+	StatusDraft:    "deleted_at",
+	StatusFailed:   "deleted_at",
+	StatusChecked:  "archived_at",
+	StatusAppealed: "archived_at",
+}
+
+// RemoveEssay hides the essay: drafts are deleted and checked essays archived. Both can
+// be restored within s.EssayRetention. Returns EssayDeleted or EssayArchived.
+func (s *UserService) RemoveEssay(essay *models.Essay) (string, error) {
+	column, ok := removalColumns[essay.Status]
+	if !ok {
+		return "", ErrWrongStatus
+	}
+
+	res, err := s.DB.Exec(`
+		UPDATE essay e SET `+column+` = NOW()
+		WHERE id = $1 AND status = $2 AND `+essayVisible,
+		essay.ID, essay.Status)
+	if err != nil {
+		return "", err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", ErrWrongStatus
+	}
+
+	if column == "archived_at" {
+		return EssayArchived, nil
+	}
+	return EssayDeleted, nil
+}
+
+// RestoreEssay brings back a deleted or archived essay of the user while it is still
+// within the retention window.
+func (s *UserService) RestoreEssay(essayID, userID uint64) error {
+	res, err := s.DB.Exec(`
+		UPDATE essay SET deleted_at = NULL, archived_at = NULL
+		WHERE id = $1 AND user_id = $2 AND COALESCE(deleted_at, archived_at) > $3`,
+		essayID, userID, time.Now().Add(-s.EssayRetention))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotRestorable
+	}
+	return nil
+}
+
+// purgeEssayQueries delete an essay ($1) and everything that references it, children
+// first. Revisions of the essay are relinked to its parent.
+var purgeEssayQueries = []string{
+	`DELETE FROM appeal_criteria WHERE appeal_id IN (SELECT id FROM appeal WHERE essay_id = $1)`,
+	`DELETE FROM appeal WHERE essay_id = $1`,
+	`DELETE FROM result_criteria WHERE result_id IN (SELECT id FROM result WHERE essay_id = $1)`,
+	`DELETE FROM result WHERE essay_id = $1`,
+	`DELETE FROM check_attempt WHERE essay_id = $1`,
+	`DELETE FROM outbox WHERE essay_id = $1`,
+	`DELETE FROM "like" WHERE essay_id = $1`,
+	`DELETE FROM comment WHERE essay_id = $1`,
+	`DELETE FROM essay_status_history WHERE essay_id = $1`,
+	`DELETE FROM exam_session WHERE essay_id = $1`,
+	`DELETE FROM essay_revision WHERE essay_id = $1`,
+	`UPDATE essay SET parent_essay_id = (SELECT parent_essay_id FROM essay WHERE id = $1) WHERE parent_essay_id = $1`,
+	`DELETE FROM essay WHERE id = $1`,
+}
+
+// PurgeRemovedEssays deletes up to limit essays removed longer than retention ago,
+// each in its own transaction. Returns how many essays were purged.
+func (s *UserService) PurgeRemovedEssays(retention time.Duration, limit int) (int, error) {
+	rows, err := s.DB.Query(`
+		SELECT id FROM essay
+		WHERE COALESCE(deleted_at, archived_at) < $1
+		ORDER BY id
+		LIMIT $2`, time.Now().Add(-retention), limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := s.purgeEssay(id); err != nil {
+			return purged, fmt.Errorf("purge essay %d: %w", id, err)
+		}
+		log.Printf("Purged essay %d", id)
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (s *UserService) purgeEssay(essayID uint64) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range purgeEssayQueries {
+		if _, err := tx.Exec(query, essayID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"essay/src/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_RemoveEssay(t *testing.T) {
+	tests := []struct {
+		status string
+		column string
+		want   string
+	}{
+		{StatusDraft, "deleted_at", EssayDeleted},
+		{StatusFailed, "deleted_at", EssayDeleted},
+		{StatusChecked, "archived_at", EssayArchived},
+		{StatusAppealed, "archived_at", EssayArchived},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db, mock, _ := sqlmock.New()
+			defer db.Close()
+
+			service := NewUserService(db)
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay e SET `+tt.column+` = NOW()`)).
+				WithArgs(uint64(7), tt.status).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			state, err := service.RemoveEssay(&models.Essay{ID: 7, Status: tt.status})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, state)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserService_RemoveEssay_InProgress(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	for _, status := range []string{StatusSaved, StatusAppeal} {
+		_, err := service.RemoveEssay(&models.Essay{ID: 7, Status: status})
+		assert.Equal(t, ErrWrongStatus, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RestoreEssay_Expired(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectExec(`UPDATE essay SET deleted_at = NULL, archived_at = NULL`).
+		WithArgs(uint64(7), uint64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, ErrNotRestorable, service.RestoreEssay(7, 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_PurgeRemovedEssays(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectQuery(`SELECT id FROM essay`).
+		WithArgs(sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectBegin()
+	for _, query := range purgeEssayQueries {
+		mock.ExpectExec(regexp.QuoteMeta(query)).
+			WithArgs(uint64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	purged, err := service.PurgeRemovedEssays(30*24*time.Hour, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPurgeEssayQueries_DeleteEssayLast(t *testing.T) {
+	// строки, ссылающиеся на сочинение, удаляются раньше него самого
+	assert.Equal(t, `DELETE FROM essay WHERE id = $1`, purgeEssayQueries[len(purgeEssayQueries)-1])
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"time"
+)
+
+// RevisableStatuses are statuses of essays that have a final result and can be revised.
+var RevisableStatuses = map[string]bool{
+	StatusChecked:  true,
+	StatusAppealed: true,
+}
+
+// revisionChain selects IDs of all essays of the revision chain of essay $1 as "chain".
+const revisionChain = `
+	WITH RECURSIVE up AS (
+		SELECT id, parent_essay_id FROM essay WHERE id = $1
+		UNION ALL
+		SELECT e.id, e.parent_essay_id FROM essay e JOIN up ON e.id = up.parent_essay_id
+	), chain AS (
+		SELECT id FROM up WHERE parent_essay_id IS NULL
+		UNION ALL
+		SELECT e.id FROM essay e JOIN chain ON e.parent_essay_id = chain.id
+	)`
+
+// ReviseEssay creates a new draft with the text and variant of the essay and links it
+// to the essay as its parent. The copied text is the first revision of the draft.
+// Returns the ID of the new draft.
+func (s *UserService) ReviseEssay(parent *models.Essay) (uint64, error) {
+	if !RevisableStatuses[parent.Status] {
+		return 0, ErrWrongStatus
+	}
+
+	var id uint64
+	err := s.DB.QueryRow(`
+		WITH e AS (
+			INSERT INTO essay (essay_text, completed_at, status, is_published, user_id, variant_id, parent_essay_id)
+			VALUES ($1, $2, $3, false, $4, $5, $6)
+			RETURNING id, essay_text, completed_at
+		)
+		INSERT INTO essay_revision (essay_id, version, essay_text, created_at)
+		SELECT id, 1, essay_text, completed_at FROM e
+		RETURNING essay_id`,
+		parent.EssayText, time.Now(), StatusDraft, parent.UserID, parent.VariantID, parent.ID,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetRevisionChain returns every essay of the revision chain the essay belongs to, from
+// the first attempt on, with the latest result of each and score deltas to its parent.
+func (s *UserService) GetRevisionChain(essayID uint64) ([]models.EssayRevision, error) {
+	query := revisionChain + `
+	SELECT
+		e.id, e.parent_essay_id, e.status, e.completed_at, r.sum_score,
+		c.id, c.code, c.title, rc.score
+	FROM essay e
+	JOIN chain ON chain.id = e.id
+	LEFT JOIN LATERAL (
+		SELECT id, sum_score FROM result WHERE essay_id = e.id ORDER BY id DESC LIMIT 1
+	) r ON TRUE
+	LEFT JOIN result_criteria rc ON rc.result_id = r.id
+	LEFT JOIN criteria c ON c.id = rc.criteria_id
+	ORDER BY e.id, c.id`
+
+	rows, err := s.DB.Query(query, essayID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chain []models.EssayRevision
+	for rows.Next() {
+		var (
+			rev        models.EssayRevision
+			parentID   sql.NullInt64
+			criteriaID sql.NullInt64
+			code       sql.NullString
+			title      sql.NullString
+			score      sql.NullInt64
+		)
+		err := rows.Scan(&rev.ID, &parentID, &rev.Status, &rev.CompletedAt, &rev.Score,
+			&criteriaID, &code, &title, &score)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(chain) == 0 || chain[len(chain)-1].ID != rev.ID {
+			if parentID.Valid {
+				id := uint64(parentID.Int64)
+				rev.ParentEssayID = &id
+			}
+			rev.Criteria = []models.RevisionCriterion{}
+			chain = append(chain, rev)
+		}
+		if !criteriaID.Valid {
+			continue
+		}
+
+		last := &chain[len(chain)-1]
+		last.Criteria = append(last.Criteria, models.RevisionCriterion{
+			CriteriaID: uint64(criteriaID.Int64),
+			Code:       code.String,
+			Title:      title.String,
+			Score:      int(score.Int64),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fillRevisionDeltas(chain)
+	return chain, nil
+}
+
+// fillRevisionDeltas compares every scored revision with its scored parent, criterion
+// by criterion.
+func fillRevisionDeltas(chain []models.EssayRevision) {
+	byID := make(map[uint64]*models.EssayRevision, len(chain))
+	for i := range chain {
+		byID[chain[i].ID] = &chain[i]
+	}
+
+	for i := range chain {
+		rev := &chain[i]
+		if rev.ParentEssayID == nil || rev.Score == nil {
+			continue
+		}
+		parent, ok := byID[*rev.ParentEssayID]
+		if !ok || parent.Score == nil {
+			continue
+		}
+
+		delta := *rev.Score - *parent.Score
+		rev.ScoreDelta = &delta
+
+		parentScores := make(map[string]int, len(parent.Criteria))
+		for _, c := range parent.Criteria {
+			parentScores[c.Code] = c.Score
+		}
+		for j := range rev.Criteria {
+			if prev, ok := parentScores[rev.Criteria[j].Code]; ok {
+				d := rev.Criteria[j].Score - prev
+				rev.Criteria[j].Delta = &d
+			}
+		}
+	}
+}
+
+// GetEssayRevisions returns saved texts of every essay of the revision chain the essay
+// belongs to, oldest first, without the texts themselves.
+func (s *UserService) GetEssayRevisions(essayID uint64) ([]models.EssayTextRevision, error) {
+	rows, err := s.DB.Query(revisionChain+`
+	SELECT r.id, r.essay_id, r.version, r.created_at
+	FROM essay_revision r
+	JOIN chain ON chain.id = r.essay_id
+	ORDER BY r.created_at, r.id`, essayID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.EssayTextRevision{}
+	for rows.Next() {
+		var rev models.EssayTextRevision
+		if err := rows.Scan(&rev.ID, &rev.EssayID, &rev.Version, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// DiffEssayRevisions returns word level changes from revision a to revision b. Both
+// revisions must belong to the revision chain of the essay, otherwise sql.ErrNoRows
+// is returned.
+func (s *UserService) DiffEssayRevisions(essayID, a, b uint64) (*models.TextDiff, error) {
+	rows, err := s.DB.Query(revisionChain+`
+	SELECT r.id, COALESCE(r.essay_text, '')
+	FROM essay_revision r
+	JOIN chain ON chain.id = r.essay_id
+	WHERE r.id IN ($2, $3)`, essayID, a, b)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	texts := make(map[uint64]string, 2)
+	for rows.Next() {
+		var id uint64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			return nil, err
+		}
+		texts[id] = text
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	from, okFrom := texts[a]
+	to, okTo := texts[b]
+	if !okFrom || !okTo {
+		return nil, sql.ErrNoRows
+	}
+
+	return &models.TextDiff{From: a, To: b, Changes: diffWords(from, to)}, nil
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_GetRevisionChain(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	now := time.Now()
+
+	mock.ExpectQuery(`WITH RECURSIVE up AS`).
+		WithArgs(uint64(9)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_essay_id", "status", "completed_at", "sum_score", "criteria_id", "code", "title", "score"}).
+			AddRow(7, nil, StatusChecked, now, 3, 1, "K1", "Позиция автора", 1).
+			AddRow(7, nil, StatusChecked, now, 3, 2, "K2", "Комментарий", 2).
+			AddRow(8, 7, StatusChecked, now, 4, 1, "K1", "Позиция автора", 1).
+			AddRow(8, 7, StatusChecked, now, 4, 2, "K2", "Комментарий", 3).
+			AddRow(9, 8, StatusDraft, now, nil, nil, nil, nil, nil))
+
+	chain, err := service.GetRevisionChain(9)
+	assert.NoError(t, err)
+	if assert.Len(t, chain, 3) {
+		assert.Nil(t, chain[0].ParentEssayID)
+		assert.Nil(t, chain[0].ScoreDelta)
+
+		assert.Equal(t, uint64(7), *chain[1].ParentEssayID)
+		assert.Equal(t, 1, *chain[1].ScoreDelta)
+		assert.Equal(t, 0, *chain[1].Criteria[0].Delta)
+		assert.Equal(t, 1, *chain[1].Criteria[1].Delta)
+
+		assert.Nil(t, chain[2].Score)
+		assert.Nil(t, chain[2].ScoreDelta)
+		assert.Empty(t, chain[2].Criteria)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"fmt"
+)
+
+// DefaultRubricCode is the rubric of variants created without an explicit rubric version.
+const DefaultRubricCode = "ege"
+
+// latestRubricVersion selects the id of the newest version of the rubric with code $N.
+const latestRubricVersion = `(SELECT rv.id FROM rubric_version rv JOIN rubric r ON r.id = rv.rubric_id
+	WHERE r.code = %s ORDER BY rv.version DESC LIMIT 1)`
+
+// GetRubrics returns all rubrics.
+func (s *UserService) GetRubrics() ([]models.Rubric, error) {
+	rows, err := s.DB.Query(`SELECT id, code, title FROM rubric ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rubrics []models.Rubric
+	for rows.Next() {
+		var r models.Rubric
+		if err := rows.Scan(&r.ID, &r.Code, &r.Title); err != nil {
+			return nil, err
+		}
+		rubrics = append(rubrics, r)
+	}
+
+	return rubrics, rows.Err()
+}
+
+// GetRubricVersion returns the given version of the rubric with its criteria.
+// Version 0 means the latest published version.
+func (s *UserService) GetRubricVersion(code string, version int) (*models.RubricVersion, error) {
+	var rv models.RubricVersion
+	err := s.DB.QueryRow(`
+		SELECT rv.id, r.code, rv.version, rv.published_at
+		FROM rubric_version rv
+		JOIN rubric r ON r.id = rv.rubric_id
+		WHERE r.code = $1 AND ($2 = 0 OR rv.version = $2)
+		ORDER BY rv.version DESC
+		LIMIT 1`, code, version).Scan(&rv.ID, &rv.RubricCode, &rv.Version, &rv.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rv.Criteria, err = s.GetCriteria(rv.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+// PublishRubricVersion stores criteria as the next version of the rubric, creating
+// the rubric on first publish. Earlier versions and results scored with them are not touched.
+func (s *UserService) PublishRubricVersion(code, title string, criteria []models.Criteria) (*models.RubricVersion, error) {
+	if err := validateRubric(code, criteria); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// upsert блокирует строку рубрики, поэтому номера версий не пересекаются
+	var rubricID uint64
+	err = tx.QueryRow(`
+		INSERT INTO rubric (code, title) VALUES ($1, $2)
+		ON CONFLICT (code) DO UPDATE SET title = COALESCE(NULLIF(EXCLUDED.title, ''), rubric.title)
+		RETURNING id`, code, title).Scan(&rubricID)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := models.RubricVersion{RubricCode: code, Criteria: criteria}
+	err = tx.QueryRow(`
+		INSERT INTO rubric_version (rubric_id, version)
+		SELECT $1, COALESCE(MAX(version), 0) + 1 FROM rubric_version WHERE rubric_id = $1
+		RETURNING id, version, published_at`, rubricID).Scan(&rv.ID, &rv.Version, &rv.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rv.Criteria {
+		c := &rv.Criteria[i]
+		err = tx.QueryRow(`
+			INSERT INTO criteria (rubric_version_id, code, title, max_score)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`, rv.ID, c.Code, c.Title, c.MaxScore).Scan(&c.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &rv, nil
+}
+
+// EssayRubricVersion returns the id and rubric code of the rubric version the essay is graded under.
+func (s *UserService) EssayRubricVersion(essayID uint64) (uint64, string, error) {
+	return essayRubricVersion(s.DB, essayID)
+}
+
+func essayRubricVersion(q querier, essayID uint64) (uint64, string, error) {
+	var id uint64
+	var code string
+	err := q.QueryRow(`
+		SELECT rv.id, r.code
+		FROM essay e
+		JOIN variant v ON v.id = e.variant_id
+		JOIN rubric_version rv ON rv.id = COALESCE(v.rubric_version_id, `+fmt.Sprintf(latestRubricVersion, "$2")+`)
+		JOIN rubric r ON r.id = rv.rubric_id
+		WHERE e.id = $1`, essayID, DefaultRubricCode).Scan(&id, &code)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return id, code, nil
+}
+
+// VariantRubricVersionID returns the rubric version of the variant, or of the
+// default rubric when variantID is 0.
+func (s *UserService) VariantRubricVersionID(variantID uint64) (uint64, error) {
+	var id sql.NullInt64
+	err := s.DB.QueryRow(`
+		SELECT COALESCE((SELECT rubric_version_id FROM variant WHERE id = $1), `+fmt.Sprintf(latestRubricVersion, "$2")+`)`,
+		variantID, DefaultRubricCode).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if !id.Valid {
+		return 0, sql.ErrNoRows
+	}
+
+	return uint64(id.Int64), nil
+}
+
+func validateRubric(code string, criteria []models.Criteria) error {
+	if code == "" {
+		return fmt.Errorf("%w: rubric code is empty", ErrInvalidRubric)
+	}
+	if len(criteria) == 0 {
+		return fmt.Errorf("%w: rubric has no criteria", ErrInvalidRubric)
+	}
+
+	seen := make(map[string]bool, len(criteria))
+	for _, c := range criteria {
+		if c.Code == "" || c.Title == "" {
+			return fmt.Errorf("%w: criterion code and title are required", ErrInvalidRubric)
+		}
+		if c.MaxScore <= 0 {
+			return fmt.Errorf("%w: %s max score must be positive", ErrInvalidRubric, c.Code)
+		}
+		if seen[c.Code] {
+			return fmt.Errorf("%w: criterion %s is repeated", ErrInvalidRubric, c.Code)
+		}
+		seen[c.Code] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"essay/src/internal/models"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_PublishRubricVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	criteria := []models.Criteria{
+		{Code: "K1", Title: "Позиция автора", MaxScore: 1},
+		{Code: "K2", Title: "Комментарий", MaxScore: 5},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO rubric \(code, title\)`).
+		WithArgs("ege", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO rubric_version \(rubric_id, version\)`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version", "published_at"}).AddRow(4, 2, time.Now()))
+	for i, c := range criteria {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO criteria (rubric_version_id, code, title, max_score)`)).
+			WithArgs(uint64(4), c.Code, c.Title, c.MaxScore).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11 + i))
+	}
+	mock.ExpectCommit()
+
+	rv, err := service.PublishRubricVersion("ege", "", criteria)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rv.Version)
+	assert.Equal(t, uint64(11), rv.Criteria[0].ID)
+	assert.Equal(t, uint64(12), rv.Criteria[1].ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_PublishRubricVersion_Invalid(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	tests := map[string][]models.Criteria{
+		"empty":    nil,
+		"no title": {{Code: "K1", MaxScore: 1}},
+		"zero max": {{Code: "K1", Title: "Позиция", MaxScore: 0}},
+		"repeated": {{Code: "K1", Title: "a", MaxScore: 1}, {Code: "K1", Title: "b", MaxScore: 1}},
+	}
+	for name, criteria := range tests {
+		_, err := service.PublishRubricVersion("ege", "", criteria)
+		assert.True(t, errors.Is(err, ErrInvalidRubric), name)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/gob"
+	"encoding/hex"
+	"essay/src/internal/models"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+// SessionStore keeps sessions in the user_session table. The cookie holds only a
+// signed random token, so a session can be listed and revoked on the server.
+type SessionStore struct {
+	DB      *sql.DB
+	Codecs  []securecookie.Codec
+	Options *sessions.Options
+}
+
+func NewSessionStore(db *sql.DB, options *sessions.Options, keyPairs ...[]byte) *SessionStore {
+	return &SessionStore{
+		DB:      db,
+		Codecs:  securecookie.CodecsFromPairs(keyPairs...),
+		Options: options,
+	}
+}
+
+// Get returns the session cached for the request or loads it.
+func (s *SessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session of the cookie. A missing, expired or revoked session gives a
+// new empty one.
+func (s *SessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.Codecs...); err != nil {
+		return session, err
+	}
+
+	var data []byte
+	err = s.DB.QueryRow(`SELECT data FROM user_session WHERE token = $1 AND expires_at > NOW()`, token).Scan(&data)
+	if err == sql.ErrNoRows {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session.Values); err != nil {
+		return session, err
+	}
+	session.ID = token
+	session.IsNew = false
+
+	// время последнего запроса обновляем не чаще раза в минуту
+	_, err = s.DB.Exec(`UPDATE user_session SET last_seen_at = NOW() WHERE token = $1 AND last_seen_at < NOW() - INTERVAL '1 minute'`, token)
+	return session, err
+}
+
+// Save stores the session and sets its cookie. MaxAge < 0 deletes the session. A
+// session whose ID was reset gets a new token, and the session of the old token in the
+// request cookie is deleted, so a fixed session ID stops working after login.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if _, err := s.DB.Exec(`DELETE FROM user_session WHERE token = $1`, session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(session.Values); err != nil {
+		return err
+	}
+	var userID sql.NullInt64
+	if id, ok := session.Values["user_id"].(uint64); ok {
+		userID = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+	expiresAt := time.Now().Add(time.Duration(session.Options.MaxAge) * time.Second)
+
+	if session.ID == "" {
+		if old := s.cookieToken(r, session.Name()); old != "" {
+			if _, err := s.DB.Exec(`DELETE FROM user_session WHERE token = $1`, old); err != nil {
+				return err
+			}
+		}
+
+		token, err := newSessionToken()
+		if err != nil {
+			return err
+		}
+		_, err = s.DB.Exec(`
+			INSERT INTO user_session (token, user_id, data, user_agent, ip, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			token, userID, data.Bytes(), r.UserAgent(), clientIP(r), expiresAt)
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	} else {
+		_, err := s.DB.Exec(`
+			UPDATE user_session SET user_id = $2, data = $3, expires_at = $4, last_seen_at = NOW()
+			WHERE token = $1`,
+			session.ID, userID, data.Bytes(), expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// cookieToken returns the session token of the request cookie, or "" if there is none.
+func (s *SessionStore) cookieToken(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.Codecs...); err != nil {
+		return ""
+	}
+	return token
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// GetUserSessions returns active sessions of the user, most recently used first.
+// The session with currentToken is marked as current.
+func (s *UserService) GetUserSessions(userID uint64, currentToken string) ([]models.UserSession, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, COALESCE(user_agent, ''), COALESCE(ip, ''), created_at, last_seen_at, token = $2
+		FROM user_session
+		WHERE user_id = $1 AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`, userID, currentToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userSessions := []models.UserSession{}
+	for rows.Next() {
+		var us models.UserSession
+		if err := rows.Scan(&us.ID, &us.UserAgent, &us.IP, &us.CreatedAt, &us.LastSeenAt, &us.Current); err != nil {
+			return nil, err
+		}
+		userSessions = append(userSessions, us)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return userSessions, nil
+}
+
+// RevokeSession ends a session of the user. Returns sql.ErrNoRows if the user has no
+// such session.
+func (s *UserService) RevokeSession(userID, sessionID uint64) error {
+	res, err := s.DB.Exec(`DELETE FROM user_session WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of the user after checking the old one, ends
+// all other sessions of the user and revokes the refresh tokens.
+func (s *UserService) ChangePassword(userID uint64, oldPassword, newPassword, currentToken string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var hash string
+	err = tx.QueryRow(`SELECT "password" FROM "user" WHERE id = $1 FOR UPDATE`, userID).Scan(&hash)
+	if err != nil {
+		return err
+	}
+	ok, _, err := verifyPassword(oldPassword, hash)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidCredentials
+	}
+
+	newHash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE "user" SET "password" = $1 WHERE id = $2`, newHash, userID); err != nil {
+		return err
+	}
+
+	// выходим на всех устройствах, кроме текущего
+	res, err := tx.Exec(`DELETE FROM user_session WHERE user_id = $1 AND token <> $2`, userID, currentToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("Password of user %d changed, %d sessions revoked", userID, n)
+	}
+	// bearer-клиенты тоже входят заново; строки остаются, чтобы повторное предъявление попало в лог
+	if _, err := tx.Exec(`UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeExpiredSessions deletes sessions that have expired.
+func (s *UserService) PurgeExpiredSessions() (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM user_session WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureArg matches any argument and remembers it.
+type captureArg struct{ value driver.Value }
+
+func (c *captureArg) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func newTestSessionStore(db *sql.DB) *SessionStore {
+	return NewSessionStore(db, &sessions.Options{Path: "/", MaxAge: 3600}, []byte("secret-key"))
+}
+
+func TestSessionStore_SaveAndLoad(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	store := newTestSessionStore(db)
+	token, data := &captureArg{}, &captureArg{}
+
+	mock.ExpectExec(`INSERT INTO user_session`).
+		WithArgs(token, sql.NullInt64{Int64: 1, Valid: true}, data, "test-agent", "192.0.2.1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	session, err := store.New(req, "session")
+	assert.NoError(t, err)
+	assert.True(t, session.IsNew)
+	session.Values["user_id"] = uint64(1)
+	session.Values["is_moderator"] = true
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, session.Save(req, rec))
+	assert.Len(t, session.ID, 64)
+	assert.Equal(t, session.ID, token.value)
+
+	// следующий запрос с тем же cookie получает сессию из базы
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT data FROM user_session WHERE token = $1 AND expires_at > NOW()`)).
+		WithArgs(session.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data.value))
+	mock.ExpectExec(`UPDATE user_session SET last_seen_at = NOW\(\)`).
+		WithArgs(session.ID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	next := httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	for _, cookie := range rec.Result().Cookies() {
+		next.AddCookie(cookie)
+	}
+	loaded, err := store.Get(next, "session")
+	assert.NoError(t, err)
+	assert.False(t, loaded.IsNew)
+	assert.Equal(t, session.ID, loaded.ID)
+	assert.Equal(t, uint64(1), loaded.Values["user_id"])
+	assert.Equal(t, true, loaded.Values["is_moderator"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionStore_SaveRotatedID(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	store := newTestSessionStore(db)
+	encoded, err := securecookie.EncodeMulti("session", "old", store.Codecs...)
+	assert.NoError(t, err)
+
+	// при входе идентификатор сбрасывается: сессия старого cookie удаляется
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE token = $1`)).
+		WithArgs("old").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	token := &captureArg{}
+	mock.ExpectExec(`INSERT INTO user_session`).
+		WithArgs(token, sql.NullInt64{Int64: 1, Valid: true}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/users/login", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: encoded})
+	session := sessions.NewSession(store, "session")
+	session.Options = &sessions.Options{Path: "/", MaxAge: 3600}
+	session.Values["user_id"] = uint64(1)
+
+	assert.NoError(t, store.Save(req, httptest.NewRecorder(), session))
+	assert.NotEqual(t, "old", session.ID)
+	assert.Equal(t, session.ID, token.value)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionStore_RevokedSession(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	store := newTestSessionStore(db)
+	mock.ExpectQuery(`SELECT data FROM user_session`).
+		WithArgs("revoked").
+		WillReturnRows(sqlmock.NewRows([]string{"data"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/info", nil)
+	cookie := sessions.NewCookie("session", "", store.Options)
+	cookie.Value, _ = encodeTestToken(store, "revoked")
+	req.AddCookie(cookie)
+
+	session, err := store.New(req, "session")
+	assert.NoError(t, err)
+	assert.True(t, session.IsNew)
+	assert.Empty(t, session.Values)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionStore_Logout(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	store := newTestSessionStore(db)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE token = $1`)).
+		WithArgs("token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/logout", nil)
+	session := sessions.NewSession(store, "session")
+	session.ID = "token"
+	session.Options = &sessions.Options{Path: "/", MaxAge: -1}
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, store.Save(req, rec, session))
+	assert.Equal(t, -1, rec.Result().Cookies()[0].MaxAge)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ChangePassword(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "password" FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(legacyPasswordHash("1234")))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET "password" = $1 WHERE id = $2`)).
+		WithArgs(sqlmock.AnyArg(), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE user_id = $1 AND token <> $2`)).
+		WithArgs(uint64(1), "current").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, service.ChangePassword(1, "1234", "new password", "current"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ChangePassword_WrongPassword(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "password" FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).AddRow(legacyPasswordHash("1234")))
+	mock.ExpectRollback()
+
+	assert.Equal(t, ErrInvalidCredentials, service.ChangePassword(1, "4321", "new password", "current"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RevokeSession_NotFound(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE id = $1 AND user_id = $2`)).
+		WithArgs(uint64(5), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.Equal(t, sql.ErrNoRows, service.RevokeSession(1, 5))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func encodeTestToken(store *SessionStore, token string) (string, error) {
+	return securecookie.EncodeMulti("session", token, store.Codecs...)
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"fmt"
+)
+
+// Essay statuses, the values of the STATUS enum.
+const (
+	StatusDraft    = "draft"
+	StatusSaved    = "saved"
+	StatusChecked  = "checked"
+	StatusAppeal   = "appeal"
+	StatusAppealed = "appealed"
+	StatusFailed   = "failed"
+)
+
+// Actors of status changes.
+const (
+	ActorUser      = "user"
+	ActorModerator = "moderator"
+	ActorChecker   = "checker"
+	ActorSystem    = "system"
+)
+
+// transitions lists the statuses an essay may move to from each status.
+var transitions = map[string][]string{
+	StatusDraft:    {StatusSaved},
+	StatusSaved:    {StatusChecked, StatusFailed},
+	StatusFailed:   {StatusSaved},
+	StatusChecked:  {StatusAppeal},
+	StatusAppeal:   {StatusAppealed},
+	StatusAppealed: {},
+}
+
+// CanTransition reports whether an essay may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ChangeEssayStatus moves the essay from one status to another and records the change.
+// It fails with ErrWrongStatus if the transition is not allowed or the essay is no longer in from.
+func (s *UserService) ChangeEssayStatus(essayID uint64, from, to string, actor models.Actor, reason string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := changeStatus(tx, essayID, from, to, actor, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// changeStatus is ChangeEssayStatus inside tx. The update is a compare-and-set on the
+// current status, so concurrent changes of the same essay cannot both succeed. Removed
+// essays keep their status until they are restored.
+func changeStatus(tx *sql.Tx, essayID uint64, from, to string, actor models.Actor, reason string) error {
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s is not allowed", ErrWrongStatus, from, to)
+	}
+
+	res, err := tx.Exec(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3 AND deleted_at IS NULL AND archived_at IS NULL`,
+		to, essayID, from)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrWrongStatus
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO essay_status_history (essay_id, from_status, to_status, actor, actor_id, reason)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6)`,
+		essayID, from, to, actor.Kind, actor.UserID, reason)
+	return err
+}
+
+// GetEssayStatusHistory returns status changes of the essay in order.
+func (s *UserService) GetEssayStatusHistory(essayID uint64) ([]models.EssayStatusChange, error) {
+	rows, err := s.DB.Query(`
+		SELECT from_status, to_status, actor, COALESCE(actor_id, 0), COALESCE(reason, ''), created_at
+		FROM essay_status_history
+		WHERE essay_id = $1
+		ORDER BY created_at, id`, essayID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.EssayStatusChange{}
+	for rows.Next() {
+		var c models.EssayStatusChange
+		if err := rows.Scan(&c.From, &c.To, &c.Actor.Kind, &c.Actor.UserID, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+
+	return history, rows.Err()
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"essay/src/internal/middleware"
+	"essay/src/internal/models"
+	"log"
+	"time"
+)
+
+// TokenRules are the key and lifetimes of bearer tokens and of links sent by mail.
+type TokenRules struct {
+	Key        []byte        // ключ подписи access-токенов и ссылок из писем
+	AccessTTL  time.Duration // сколько действует access-токен
+	RefreshTTL time.Duration // сколько действует refresh-токен
+	VerifyTTL  time.Duration // сколько действует ссылка подтверждения почты
+	ResetTTL   time.Duration // сколько действует ссылка восстановления пароля
+	// как часто можно запрашивать новую ссылку того же назначения
+	MailCooldown time.Duration
+}
+
+// DefaultTokenRules are used until the application sets its own. Without a key no
+// token can be issued.
+var DefaultTokenRules = TokenRules{
+	AccessTTL:    15 * time.Minute,
+	RefreshTTL:   30 * 24 * time.Hour,
+	VerifyTTL:    48 * time.Hour,
+	ResetTTL:     time.Hour,
+	MailCooldown: 5 * time.Minute,
+}
+
+// IssueTokens signs the user in by mail and password and returns a new access token
+// with a refresh token that starts a new rotation family.
+func (s *UserService) IssueTokens(mail, password string) (*models.TokenPair, error) {
+	user, err := s.Authenticate(mail, password)
+	if err != nil {
+		return nil, err
+	}
+
+	family, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pair, err := s.newTokenPair(tx, user, family)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new pair. Every refresh token works
+// once: a token that is presented again was stolen or leaked, so its whole family is
+// revoked and the user has to sign in again. Revoked tokens are kept until they
+// expire, so later replays are still recognised and logged.
+func (s *UserService) RefreshTokens(refreshToken string) (*models.TokenPair, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id      uint64
+		family  string
+		expired bool
+		used    bool
+		revoked bool
+		user    models.User
+	)
+	err = tx.QueryRow(`
+		SELECT r.id, r.family, r.expires_at <= NOW(), r.used_at IS NOT NULL, r.revoked_at IS NOT NULL, u.id, u.is_moderator, u.is_admin
+		FROM refresh_token r
+		JOIN "user" u ON u.id = r.user_id
+		WHERE r.token_hash = $1
+		FOR UPDATE OF r`, tokenHash(refreshToken)).
+		Scan(&id, &family, &expired, &used, &revoked, &user.ID, &user.IsModerator, &user.IsAdmin)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		log.Printf("Revoked refresh token %d of user %d presented again", id, user.ID)
+		return nil, ErrInvalidRefreshToken
+	}
+	if used {
+		// повторное использование: отзываем всю цепочку токенов
+		_, err := tx.Exec(`UPDATE refresh_token SET revoked_at = NOW() WHERE family = $1 AND revoked_at IS NULL`, family)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		log.Printf("Refresh token %d of user %d reused, token family revoked", id, user.ID)
+		return nil, ErrInvalidRefreshToken
+	}
+	if expired {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_token SET used_at = NOW() WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	pair, err := s.newTokenPair(tx, &user, family)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeRefreshToken ends the rotation family of the refresh token, signing the client
+// out. An unknown token is not an error.
+func (s *UserService) RevokeRefreshToken(refreshToken string) error {
+	_, err := s.DB.Exec(`
+		UPDATE refresh_token SET revoked_at = NOW()
+		WHERE family = (SELECT family FROM refresh_token WHERE token_hash = $1) AND revoked_at IS NULL`,
+		tokenHash(refreshToken))
+	return err
+}
+
+// PurgeExpiredRefreshTokens deletes refresh tokens that have expired, revoked ones
+// included.
+func (s *UserService) PurgeExpiredRefreshTokens() (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM refresh_token WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *UserService) newTokenPair(tx *sql.Tx, user *models.User, family string) (*models.TokenPair, error) {
+	now := time.Now()
+	accessToken, err := middleware.SignToken(s.Tokens.Key, middleware.TokenClaims{
+		UserID:      user.ID,
+		IsModerator: user.IsModerator,
+		IsAdmin:     user.IsAdmin,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(s.Tokens.AccessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := newSessionToken()
+	if err != nil {
+		return nil, err
+	}
+	// в базе хранится только хеш: утечка таблицы не даёт действующих токенов
+	_, err = tx.Exec(`
+		INSERT INTO refresh_token (token_hash, family, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		tokenHash(refreshToken), family, user.ID, now.Add(s.Tokens.RefreshTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.Tokens.AccessTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// tokenHash is the form in which refresh and account tokens are stored.
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"essay/src/internal/middleware"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+const selectRefreshToken = `SELECT r.id, r.family, r.expires_at <= NOW(), r.used_at IS NOT NULL, r.revoked_at IS NOT NULL, u.id, u.is_moderator, u.is_admin`
+
+func newTokenService(t *testing.T) (*UserService, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	service := NewUserService(db)
+	service.Tokens.Key = []byte("token key")
+	return service, mock
+}
+
+func TestUserService_IssueTokens(t *testing.T) {
+	service, mock := newTokenService(t)
+	hash, err := hashPassword("1234")
+	assert.NoError(t, err)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
+		WithArgs("moderator@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator", "is_admin"}).AddRow(3, hash, true, false))
+	mock.ExpectBegin()
+	stored := &captureArg{}
+	mock.ExpectExec(`INSERT INTO refresh_token \(token_hash, family, user_id, expires_at\)`).
+		WithArgs(stored, sqlmock.AnyArg(), uint64(3), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	pair, err := service.IssueTokens("moderator@example.com", "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 15*60, pair.ExpiresIn)
+	// в базе только хеш refresh-токена
+	assert.Equal(t, tokenHash(pair.RefreshToken), stored.value)
+
+	claims, err := middleware.ParseToken(service.Tokens.Key, pair.AccessToken, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), claims.UserID)
+	assert.True(t, claims.IsModerator)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RefreshTokens_Rotates(t *testing.T) {
+	service, mock := newTokenService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectRefreshToken)).
+		WithArgs(tokenHash("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family", "expired", "used", "revoked", "user_id", "is_moderator", "is_admin"}).
+			AddRow(5, "family", false, false, false, 1, false, false))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_token SET used_at = NOW() WHERE id = $1`)).
+		WithArgs(uint64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO refresh_token`).
+		WithArgs(sqlmock.AnyArg(), "family", uint64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(6, 1))
+	mock.ExpectCommit()
+
+	pair, err := service.RefreshTokens("old")
+	assert.NoError(t, err)
+	assert.NotEqual(t, "old", pair.RefreshToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RefreshTokens_ReuseRevokesFamily(t *testing.T) {
+	service, mock := newTokenService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectRefreshToken)).
+		WithArgs(tokenHash("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family", "expired", "used", "revoked", "user_id", "is_moderator", "is_admin"}).
+			AddRow(5, "family", false, true, false, 1, false, false))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_token SET revoked_at = NOW() WHERE family = $1 AND revoked_at IS NULL`)).
+		WithArgs("family").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	_, err := service.RefreshTokens("old")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RefreshTokens_Revoked(t *testing.T) {
+	service, mock := newTokenService(t)
+
+	// отозванная цепочка остаётся в таблице: повтор распознаётся, а не выглядит как неизвестный токен
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectRefreshToken)).
+		WithArgs(tokenHash("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family", "expired", "used", "revoked", "user_id", "is_moderator", "is_admin"}).
+			AddRow(5, "family", false, true, true, 1, false, false))
+	mock.ExpectRollback()
+
+	_, err := service.RefreshTokens("old")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RefreshTokens_Expired(t *testing.T) {
+	service, mock := newTokenService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(selectRefreshToken)).
+		WithArgs(tokenHash("old")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family", "expired", "used", "revoked", "user_id", "is_moderator", "is_admin"}).
+			AddRow(5, "family", true, false, false, 1, false, false))
+	mock.ExpectRollback()
+
+	_, err := service.RefreshTokens("old")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,34 +1,28 @@
 package services
 
 import (
-	"crypto/sha256"
 	"database/sql"
 	"essay/src/internal/models"
-	"fmt"
+	"log"
 	"strings"
 )
 
-func hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return fmt.Sprintf("%x", hash[:])
-}
-
 func (s *UserService) GetUserInfoByID(id uint64) (*models.UserInfo, error) {
 	user := &models.UserInfo{}
 
 	query := `SELECT 
-	u.id, u.mail, u.nickname, u.is_moderator, u.count_checks,
+	u.id, u.mail, u.nickname, u.is_moderator, u.email_verified, u.count_checks,
 	COUNT(e.id) AS count_essays, 
 	COUNT(CASE WHEN e.is_published THEN 1 END) AS count_published_essays,
 	COALESCE(AVG(r.sum_score), 0) AS average_result
 	FROM "user" u
-	LEFT JOIN essay e ON u.id = e.user_id
+	LEFT JOIN essay e ON u.id = e.user_id AND ` + essayVisible + `
 	LEFT JOIN result r ON e.id = r.essay_id
 	WHERE u.id = $1
-	GROUP BY u.id, u.mail, u.nickname, u.is_moderator, u.count_checks`
+	GROUP BY u.id, u.mail, u.nickname, u.is_moderator, u.email_verified, u.count_checks`
 
 	err := s.DB.QueryRow(query, id).Scan(
-		&user.ID, &user.Mail, &user.Nickname, &user.IsModerator,
+		&user.ID, &user.Mail, &user.Nickname, &user.IsModerator, &user.EmailVerified,
 		&user.CountChecks, &user.CountEssays, &user.CountPublishedEssays, &user.AverageResult)
 
 	if err != nil {
@@ -89,11 +83,19 @@ func (s *UserService) GetNickname(mail string) (string, error) {
 	return nickname, nil
 }
 
+// CreateUser registers the user and mails a link to confirm the address. Until it is
+// confirmed the user cannot submit essays for check.
 func (s *UserService) CreateUser(user *models.User) error {
-	hashedPassword := hashPassword(user.Password)
+	if err := validateMail(user.Mail); err != nil {
+		return err
+	}
+	hashedPassword, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
 
-	query := `INSERT INTO "user" (mail, nickname, "password") VALUES ($1, $2, $3)`
-	_, err := s.DB.Exec(query, user.Mail, user.Nickname, hashedPassword)
+	query := `INSERT INTO "user" (mail, nickname, "password") VALUES ($1, $2, $3) RETURNING id`
+	err = s.DB.QueryRow(query, user.Mail, user.Nickname, hashedPassword).Scan(&user.ID)
 	if err != nil {
 		if strings.Contains(err.Error(), "unique constraint") {
 			return ErrDuplicateEmail
@@ -101,26 +103,63 @@ func (s *UserService) CreateUser(user *models.User) error {
 		return err
 	}
 
+	// письмо можно запросить повторно, поэтому ошибка отправки не отменяет регистрацию
+	if err := s.sendVerification(user.ID, user.Mail, user.Nickname); err != nil {
+		log.Printf("Failed to send verification mail to user %d: %v", user.ID, err)
+	}
+
 	return nil
 }
 
+// UpdateUser changes the mail and nickname of the user. A new address has to be
+// confirmed again: links sent to the old address stop working together with the change.
 func (s *UserService) UpdateUser(mail string, nickname string, id uint64) error {
-	query := `UPDATE "user" SET mail = $1, nickname = $2 WHERE id = $3`
-	_, err := s.DB.Exec(query, mail, nickname, id)
+	if err := validateMail(mail); err != nil {
+		return err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var mailChanged bool
+	query := `
+		UPDATE "user" u SET mail = $1, nickname = $2, email_verified = u.email_verified AND old.mail = $1
+		FROM (SELECT mail FROM "user" WHERE id = $3) old
+		WHERE u.id = $3
+		RETURNING old.mail <> $1`
+	err = tx.QueryRow(query, mail, nickname, id).Scan(&mailChanged)
 	if err != nil {
 		if strings.Contains(err.Error(), "unique constraint") {
 			return ErrDuplicateEmail
 		}
 		return err
 	}
+	if mailChanged {
+		_, err = tx.Exec(`DELETE FROM account_token WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, id, TokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if mailChanged {
+		if err := s.sendVerification(id, mail, nickname); err != nil {
+			log.Printf("Failed to send verification mail to user %d: %v", id, err)
+		}
+	}
 
 	return nil
 }
 
 func (s *UserService) Authenticate(mail, password string) (*models.User, error) {
 	user := &models.User{}
-	query := `SELECT id, password, is_moderator FROM "user" WHERE mail = $1`
-	err := s.DB.QueryRow(query, mail).Scan(&user.ID, &user.Password, &user.IsModerator)
+	query := `SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`
+	err := s.DB.QueryRow(query, mail).Scan(&user.ID, &user.Password, &user.IsModerator, &user.IsAdmin)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrInvalidCredentials
@@ -128,13 +167,34 @@ func (s *UserService) Authenticate(mail, password string) (*models.User, error)
 		return nil, err
 	}
 
-	if hashPassword(password) != user.Password {
+	ok, needsRehash, err := verifyPassword(password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
 		return nil, ErrInvalidCredentials
 	}
 
+	// устаревший хеш заменяем, пока известен пароль; ошибка не мешает входу
+	if needsRehash {
+		if err := s.rehashPassword(user.ID, user.Password, password); err != nil {
+			log.Printf("Failed to rehash password of user %d: %v", user.ID, err)
+		}
+	}
+
 	return user, nil
 }
 
+// rehashPassword replaces the stored hash of the user if it is still oldHash.
+func (s *UserService) rehashPassword(userID uint64, oldHash, password string) error {
+	newHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(`UPDATE "user" SET "password" = $1 WHERE id = $2 AND "password" = $3`, newHash, userID, oldHash)
+	return err
+}
+
 func (s *UserService) DecreaseCheckCount(userID uint64) error {
 	var checkCount int
 	err := s.DB.QueryRow(`SELECT count_checks FROM "user" WHERE id = $1`, userID).Scan(&checkCount)
@@ -150,6 +210,12 @@ func (s *UserService) DecreaseCheckCount(userID uint64) error {
 	return err
 }
 
+// RefundCheck returns a check spent on an essay that was never checked.
+func (s *UserService) RefundCheck(userID uint64) error {
+	_, err := s.DB.Exec(`UPDATE "user" SET count_checks = count_checks + 1 WHERE id = $1`, userID)
+	return err
+}
+
 func (s *UserService) ResetAllChecks() error {
 	tx, err := s.DB.Begin()
 	if err != nil {
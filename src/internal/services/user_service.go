@@ -3,23 +3,70 @@ package services
 import (
 	"database/sql"
 	"errors"
+	"essay/src/internal/mailer"
+	"time"
 )
 
 var (
-	ErrDuplicateEmail     = errors.New("email already in use")
-	ErrInvalidCredentials = errors.New("invalid email or password")
-	ErrWrongID            = errors.New("wrong id")
-	ErrLikeAlreadyExists  = errors.New("like already exists")
-	ErrLikeNotFound       = errors.New("like doesn't exists")
-	ErrNoChecksLeft       = errors.New("no checks left")
+	ErrDuplicateEmail      = errors.New("email already in use")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrWrongID             = errors.New("wrong id")
+	ErrLikeAlreadyExists   = errors.New("like already exists")
+	ErrLikeNotFound        = errors.New("like doesn't exists")
+	ErrNoChecksLeft        = errors.New("no checks left")
+	ErrResultExists        = errors.New("result already exists")
+	ErrWrongStatus         = errors.New("wrong essay status")
+	ErrInvalidResult       = errors.New("invalid result")
+	ErrInvalidRubric       = errors.New("invalid rubric")
+	ErrInvalidAppeal       = errors.New("invalid appeal")
+	ErrAppealClaimed       = errors.New("appeal is claimed by another moderator")
+	ErrAppealNotClaimed    = errors.New("appeal is not claimed")
+	ErrAppealClosed        = errors.New("appeal is closed")
+	ErrAppealExists        = errors.New("essay has already been appealed")
+	ErrAppealWindowClosed  = errors.New("appeal window is closed")
+	ErrAppealQuotaExceeded = errors.New("monthly appeal quota exceeded")
+	ErrVersionConflict     = errors.New("essay version conflict")
+	ErrNotRestorable       = errors.New("essay is not removed or its retention window has passed")
+	ErrExamTimeOver        = errors.New("exam time is over")
+	ErrExamInProgress      = errors.New("another exam session is in progress")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidEmail        = errors.New("invalid email address")
+	ErrEmailNotVerified    = errors.New("email address is not verified")
+	ErrEmailVerified       = errors.New("email address is already verified")
+	ErrInvalidAccountToken = errors.New("invalid or expired link")
+	ErrMailCooldown        = errors.New("a link was sent recently, try again later")
+	ErrMailQueueFull       = errors.New("too many mail requests, try again later")
 )
 
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 type UserService struct {
-	DB *sql.DB
+	DB             *sql.DB
+	AppealRules    AppealRules
+	OutboxRules    OutboxRules
+	EssayRetention time.Duration // сколько удалённое или архивное сочинение можно восстановить
+	ExamDuration   time.Duration // сколько длится экзаменационная сессия
+	Tokens         TokenRules
+	Mailer         mailer.Mailer
+	AppURL         string // адрес фронтенда для ссылок в письмах
+
+	passwordResets chan string // адреса, ждущие письма со ссылкой восстановления пароля
 }
 
 func NewUserService(db *sql.DB) *UserService {
 	return &UserService{
-		DB: db,
+		DB:             db,
+		AppealRules:    DefaultAppealRules,
+		OutboxRules:    DefaultOutboxRules,
+		EssayRetention: DefaultEssayRetention,
+		ExamDuration:   DefaultExamDuration,
+		Tokens:         DefaultTokenRules,
+		Mailer:         mailer.NewLogMailer("noreply@localhost", ""),
+		AppURL:         "http://localhost:3000",
+		passwordResets: make(chan string, 100),
 	}
 }
@@ -19,6 +19,9 @@ func TestCreateUser(t *testing.T) {
 	defer db.Close()
 
 	userService := NewUserService(db)
+	userService.Tokens.Key = []byte("token key")
+	sent := &testMailer{}
+	userService.Mailer = sent
 
 	// Тест успешного создания пользователя
 	user := &models.User{
@@ -27,29 +30,70 @@ func TestCreateUser(t *testing.T) {
 		Password: "password123",
 	}
 
-	// Мокируем успешный запрос на создание пользователя
-	mock.ExpectExec(`INSERT INTO "user" \(mail, nickname, password\)`).
-		WithArgs(user.Mail, user.Nickname, hashPassword(user.Password)).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Мокируем успешный запрос на создание пользователя и выпуск ссылки подтверждения
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "user" (mail, nickname, "password") VALUES ($1, $2, $3) RETURNING id`)).
+		WithArgs(user.Mail, user.Nickname, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	expectAccountToken(mock, 1, TokenVerifyEmail)
+	mock.ExpectCommit()
 
 	err = userService.CreateUser(user)
 	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), user.ID)
+	if assert.Len(t, sent.sent, 1) {
+		assert.Equal(t, "test@example.com", sent.sent[0].To)
+		assert.Contains(t, sent.sent[0].Body, "testuser")
+		assert.Contains(t, sent.sent[0].Body, "http://localhost:3000/verify-email?token=")
+	}
 
 	// Проверка на дублирование email
-	mock.ExpectExec(`INSERT INTO "user" \(mail, nickname, password\)`).
-		WithArgs(user.Mail, user.Nickname, hashPassword(user.Password)).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "user" (mail, nickname, "password")`)).
+		WithArgs(user.Mail, user.Nickname, sqlmock.AnyArg()).
 		WillReturnError(errors.New("duplicate key value violates unique constraint"))
 
 	err = userService.CreateUser(user)
 	assert.Equal(t, ErrDuplicateEmail, err)
 
 	// Проверка на ошибку при выполнении запроса
-	mock.ExpectExec(`INSERT INTO "user" \(mail, nickname, password\)`).
-		WithArgs(user.Mail, user.Nickname, hashPassword(user.Password)).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "user" (mail, nickname, "password")`)).
+		WithArgs(user.Mail, user.Nickname, sqlmock.AnyArg()).
 		WillReturnError(errors.New("some error"))
 
 	err = userService.CreateUser(user)
 	assert.Error(t, err)
+
+	// письма отправлены только после успешной регистрации
+	assert.Len(t, sent.sent, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUser_MailChanged(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Не удалось создать мок базы данных: %v", err)
+	}
+	defer db.Close()
+
+	userService := NewUserService(db)
+	sent := &testMailer{}
+	userService.Mailer = sent
+
+	// ссылки на старый адрес удаляются в той же транзакции, что и смена адреса;
+	// без ключа новая ссылка не выпускается, но старые уже не подтвердят новый адрес
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE "user" u SET mail = \$1, nickname = \$2`).
+		WithArgs("new@example.com", "testuser", uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"changed"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM account_token WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`)).
+		WithArgs(uint64(1), TokenVerifyEmail).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = userService.UpdateUser("new@example.com", "testuser", 1)
+	assert.NoError(t, err)
+	assert.Empty(t, sent.sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 func TestAuthenticate(t *testing.T) {
@@ -60,12 +104,14 @@ func TestAuthenticate(t *testing.T) {
 	defer db.Close()
 
 	userService := NewUserService(db)
+	hash, err := hashPassword("password123")
+	assert.NoError(t, err)
 
 	// Тест успешной аутентификации
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator FROM "user" WHERE mail = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
 		WithArgs("test@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator"}).
-			AddRow(1, hashPassword("password123"), false))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator", "is_admin"}).
+			AddRow(1, hash, false, false))
 
 	user, err := userService.Authenticate("test@example.com", "password123")
 	assert.NoError(t, err)
@@ -73,17 +119,17 @@ func TestAuthenticate(t *testing.T) {
 	assert.Equal(t, uint64(1), user.ID)
 
 	// Тест неудачной аутентификации из-за неправильного пароля
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator FROM "user" WHERE mail = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
 		WithArgs("test@example.com").
-		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator"}).
-			AddRow(1, hashPassword("password123"), false))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "password", "is_moderator", "is_admin"}).
+			AddRow(1, hash, false, false))
 
 	user, err = userService.Authenticate("test@example.com", "wrongpassword")
 	assert.Equal(t, ErrInvalidCredentials, err)
 	assert.Nil(t, user)
 
 	// Тест неудачной аутентификации из-за отсутствия пользователя
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator FROM "user" WHERE mail = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, password, is_moderator, is_admin FROM "user" WHERE mail = $1`)).
 		WithArgs("nonexistent@example.com").
 		WillReturnError(sql.ErrNoRows)
 
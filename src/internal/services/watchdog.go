@@ -0,0 +1,155 @@
+package services
+
+import (
+	"database/sql"
+	"essay/src/internal/models"
+	"fmt"
+	"log"
+	"time"
+)
+
+type stuckEssay struct {
+	essay         models.Essay
+	attemptNumber int
+}
+
+// RetryStuckChecks finds saved essays whose last check attempt is older than sla
+// and has no result. The last attempt is the newest one: attempts are numbered from 1
+// again each time the essay is submitted. They are sent again until maxAttempts is reached; after that
+// the essay is marked failed and the check is refunded.
+func (s *UserService) RetryStuckChecks(sla time.Duration, maxAttempts int) (retried int, failed int, err error) {
+	rows, err := s.DB.Query(`
+		SELECT e.id, e.essay_text, e.user_id, e.variant_id, COALESCE(a.attempt_number, 0)
+		FROM essay e
+		LEFT JOIN LATERAL (
+			SELECT attempt_number, created_at
+			FROM check_attempt
+			WHERE essay_id = e.id
+			ORDER BY created_at DESC, id DESC
+			LIMIT 1
+		) a ON true
+		WHERE e.status = 'saved'
+			AND (a.created_at IS NULL OR a.created_at < $1)
+			AND NOT EXISTS (SELECT 1 FROM result r WHERE r.essay_id = e.id)`,
+		time.Now().Add(-sla))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var stuck []stuckEssay
+	for rows.Next() {
+		var e stuckEssay
+		if err := rows.Scan(&e.essay.ID, &e.essay.EssayText, &e.essay.UserID, &e.essay.VariantID, &e.attemptNumber); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		stuck = append(stuck, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, e := range stuck {
+		if e.attemptNumber < maxAttempts {
+			if err := s.retryCheck(e); err != nil {
+				log.Printf("Failed to retry check of essay %d: %v", e.essay.ID, err)
+				continue
+			}
+			retried++
+		} else {
+			if err := s.failCheck(e); err != nil {
+				log.Printf("Failed to mark check of essay %d as failed: %v", e.essay.ID, err)
+				continue
+			}
+			failed++
+		}
+	}
+
+	return retried, failed, nil
+}
+
+func (s *UserService) retryCheck(e stuckEssay) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// результат мог прийти, пока сочинения перебирались
+	var status string
+	if err := tx.QueryRow(`SELECT status FROM essay WHERE id = $1 FOR UPDATE`, e.essay.ID).Scan(&status); err != nil {
+		return err
+	}
+	if status != StatusSaved {
+		return ErrWrongStatus
+	}
+
+	if err := closeAttempts(tx, e.essay.ID, "timed_out"); err != nil {
+		return err
+	}
+	if err := enqueueCheck(tx, &e.essay, e.attemptNumber+1); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *UserService) failCheck(e stuckEssay) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = changeStatus(tx, e.essay.ID, StatusSaved, StatusFailed,
+		models.Actor{Kind: ActorSystem}, fmt.Sprintf("no check result after %d attempts", e.attemptNumber))
+	if err != nil {
+		return err
+	}
+
+	if err := closeAttempts(tx, e.essay.ID, "failed"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE "user" SET count_checks = count_checks + 1 WHERE id = $1`, e.essay.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// closeAttempts finishes pending attempts of the essay and drops their undelivered outbox
+// rows. Dead letters are kept.
+func closeAttempts(tx *sql.Tx, essayID uint64, status string) error {
+	_, err := tx.Exec(`UPDATE check_attempt SET status = $1, finished_at = NOW() WHERE essay_id = $2 AND status = 'pending'`,
+		status, essayID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM outbox WHERE essay_id = $1 AND status = 'pending'`, essayID)
+	return err
+}
+
+// GetCheckAttempts returns check attempts of the essay in order.
+func (s *UserService) GetCheckAttempts(essayID uint64) ([]models.CheckAttempt, error) {
+	rows, err := s.DB.Query(`
+		SELECT attempt_number, status, created_at, finished_at
+		FROM check_attempt
+		WHERE essay_id = $1
+		ORDER BY attempt_number`, essayID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.CheckAttempt
+	for rows.Next() {
+		var attempt models.CheckAttempt
+		if err := rows.Scan(&attempt.AttemptNumber, &attempt.Status, &attempt.CreatedAt, &attempt.FinishedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, rows.Err()
+}
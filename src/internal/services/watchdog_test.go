@@ -0,0 +1,121 @@
+package services
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserService_RetryStuckChecks(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`SELECT e.id, e.essay_text, e.user_id, e.variant_id, COALESCE\(a.attempt_number, 0\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text", "user_id", "variant_id", "attempt_number"}).
+			AddRow(1, "retry me", 10, 2, 1).
+			AddRow(2, "give up", 20, 2, 3))
+
+	// первое сочинение отправляется повторно
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT status FROM essay WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusSaved))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE check_attempt SET status = $1, finished_at = NOW() WHERE essay_id = $2 AND status = 'pending'`)).
+		WithArgs("timed_out", uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM outbox WHERE essay_id = $1 AND status = 'pending'`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_text, COALESCE(author_position, '') FROM variant WHERE id = $1`)).
+		WithArgs(uint64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text", "author_position"}).AddRow("variant", "position"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO check_attempt (essay_id, attempt_id, attempt_number) VALUES ($1, $2, $3)`)).
+		WithArgs(uint64(1), sqlmock.AnyArg(), 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO outbox (essay_id, payload) VALUES ($1, $2)`)).
+		WithArgs(uint64(1), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	// второе исчерпало попытки: failed и возврат проверки
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusFailed, uint64(2), StatusSaved).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WithArgs(uint64(2), StatusSaved, StatusFailed, ActorSystem, uint64(0), "no check result after 3 attempts").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE check_attempt SET status = $1, finished_at = NOW() WHERE essay_id = $2 AND status = 'pending'`)).
+		WithArgs("failed", uint64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM outbox WHERE essay_id = $1 AND status = 'pending'`)).
+		WithArgs(uint64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks + 1 WHERE id = $1`)).
+		WithArgs(uint64(20)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	retried, failed, err := service.RetryStuckChecks(10*time.Minute, 3)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retried)
+	assert.Equal(t, 1, failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RetryStuckChecks_AlreadyChecked(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	mock.ExpectQuery(`SELECT e.id, e.essay_text, e.user_id, e.variant_id, COALESCE\(a.attempt_number, 0\)`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text", "user_id", "variant_id", "attempt_number"}).
+			AddRow(2, "give up", 20, 2, 3))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(StatusFailed, uint64(2), StatusSaved).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	retried, failed, err := service.RetryStuckChecks(10*time.Minute, 3)
+
+	assert.NoError(t, err)
+	assert.Zero(t, retried)
+	assert.Zero(t, failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_RetryStuckChecks_NoLongerSaved(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	service := NewUserService(db)
+
+	// после повторной отправки нумерация попыток начинается заново,
+	// поэтому последняя попытка — самая новая, а не с наибольшим номером
+	mock.ExpectQuery(`ORDER BY created_at DESC, id DESC`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text", "user_id", "variant_id", "attempt_number"}).
+			AddRow(1, "resubmitted", 10, 2, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT status FROM essay WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(StatusChecked))
+	mock.ExpectRollback()
+
+	retried, failed, err := service.RetryStuckChecks(10*time.Minute, 3)
+
+	assert.NoError(t, err)
+	assert.Zero(t, retried)
+	assert.Zero(t, failed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
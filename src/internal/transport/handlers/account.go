@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"essay/src/internal/middleware"
+	"essay/src/internal/services"
+	"log"
+	"net/http"
+)
+
+// VerifyEmail handles POST /users/verify-email ({token} from the link in the mail).
+func (h *UserHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqBody struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.VerifyEmail(reqBody.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_token", err)
+			return
+		}
+		log.Printf("Error verifying email: %v", err)
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification handles POST /users/me/verify-email: mails a new link.
+func (h *UserHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+	if err := h.UserService.ResendVerification(userID); err != nil {
+		if errors.Is(err, services.ErrEmailVerified) {
+			writeErrorCode(w, http.StatusConflict, "email_verified", err)
+			return
+		}
+		if errors.Is(err, services.ErrMailCooldown) {
+			writeErrorCode(w, http.StatusTooManyRequests, "mail_cooldown", err)
+			return
+		}
+		log.Printf("Error sending verification mail to user %d: %v", userID, err)
+		http.Error(w, "Error sending mail", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// RequestPasswordReset handles POST /users/password-reset ({mail}). The request is
+// only queued, so the answer is the same whether the address is registered or not.
+func (h *UserHandler) RequestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqBody struct {
+		Mail string `json:"mail"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.Mail == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.RequestPasswordReset(reqBody.Mail); err != nil {
+		log.Printf("Error requesting password reset: %v", err)
+		writeErrorCode(w, http.StatusServiceUnavailable, "mail_queue_full", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword handles POST /users/password-reset/confirm ({token, new_password}).
+// All sessions and refresh tokens of the user are revoked.
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqBody struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if reqBody.NewPassword == "" {
+		http.Error(w, "New password is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.ResetPassword(reqBody.Token, reqBody.NewPassword); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			writeErrorCode(w, http.StatusBadRequest, "invalid_token", err)
+			return
+		}
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"essay/src/internal/middleware"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HandleAppeal handles moderator actions on an appeal:
+// GET /appeals/{id},
+// POST /appeals/{id}/claim, /appeals/{id}/release,
+// POST /appeals/{id}/resolve ({result, comment}), /appeals/{id}/reject ({comment})
+func (h *UserHandler) HandleAppeal(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+
+	moderatorID := middleware.PrincipalFrom(r.Context()).UserID
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	appealID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid appeal ID", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.getAppeal(w, appealID)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Result  models.DetailedResult `json:"result"`
+		Comment string                `json:"comment"`
+	}
+	if parts[2] == "resolve" || parts[2] == "reject" {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch parts[2] {
+	case "claim":
+		err = h.UserService.ClaimAppeal(appealID, moderatorID)
+	case "release":
+		err = h.UserService.ReleaseAppeal(appealID, moderatorID)
+	case "resolve":
+		err = h.UserService.ResolveAppeal(appealID, moderatorID, &req.Result, req.Comment)
+	case "reject":
+		err = h.UserService.RejectAppeal(appealID, moderatorID, req.Comment)
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeAppealError(w, appealID, err)
+		return
+	}
+
+	log.Printf("Appeal %d: %s by moderator %d", appealID, parts[2], moderatorID)
+	h.getAppeal(w, appealID)
+}
+
+func (h *UserHandler) getAppeal(w http.ResponseWriter, appealID uint64) {
+	appeal, err := h.UserService.GetAppeal(appealID)
+	if err != nil {
+		h.writeAppealError(w, appealID, err)
+		return
+	}
+
+	essay, err := h.UserService.GetDetailedEssayByID(appeal.EssayID)
+	if err != nil {
+		log.Printf("Error GetDetailedEssayByID: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*models.Appeal
+		Essay *models.DetailedEssay `json:"essay"`
+	}{appeal, essay})
+}
+
+// writeErrorCode writes a JSON error with a machine readable code.
+func writeErrorCode(w http.ResponseWriter, status int, code string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   code,
+		"message": err.Error(),
+	})
+}
+
+// writeAppealError maps appeal errors to responses.
+func (h *UserHandler) writeAppealError(w http.ResponseWriter, appealID uint64, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Appeal not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrAppealClaimed):
+		http.Error(w, "Appeal is claimed by another moderator", http.StatusConflict)
+	case errors.Is(err, services.ErrAppealNotClaimed):
+		http.Error(w, "Appeal is not claimed", http.StatusConflict)
+	case errors.Is(err, services.ErrAppealClosed):
+		http.Error(w, "Appeal is already closed", http.StatusConflict)
+	case errors.Is(err, services.ErrWrongStatus):
+		http.Error(w, "Essay is not under appeal", http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidResult):
+		log.Printf("Rejected result for appeal %d: %v", appealID, err)
+		writeValidationError(w, err)
+	case errors.Is(err, services.ErrInvalidAppeal):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Failed to process appeal %d: %v", appealID, err)
+		http.Error(w, "Failed to process appeal", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"log"
+	"net/http"
+)
+
+// IssueToken handles POST /auth/token for bearer clients:
+// {grant_type: "password", mail, password} signs in,
+// {grant_type: "refresh_token", refresh_token} rotates the refresh token.
+func (h *UserHandler) IssueToken(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqBody struct {
+		GrantType    string `json:"grant_type"`
+		Mail         string `json:"mail"`
+		Password     string `json:"password"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var pair *models.TokenPair
+	var err error
+	switch reqBody.GrantType {
+	case "password":
+		pair, err = h.UserService.IssueTokens(reqBody.Mail, reqBody.Password)
+	case "refresh_token":
+		pair, err = h.UserService.RefreshTokens(reqBody.RefreshToken)
+	default:
+		writeErrorCode(w, http.StatusBadRequest, "unsupported_grant_type",
+			errors.New(`grant_type must be "password" or "refresh_token"`))
+		return
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) || errors.Is(err, services.ErrInvalidRefreshToken) {
+			writeErrorCode(w, http.StatusUnauthorized, "invalid_grant", err)
+			return
+		}
+		log.Printf("Error issuing tokens: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(pair)
+}
+
+// RevokeToken handles POST /auth/revoke ({refresh_token}): signs the bearer client out.
+func (h *UserHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reqBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.RefreshToken == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.RevokeRefreshToken(reqBody.RefreshToken); err != nil {
+		log.Printf("Error revoking refresh token: %v", err)
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,7 +4,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"essay/src/internal/config"
+	"essay/src/internal/middleware"
 	"essay/src/internal/models"
 	"essay/src/internal/services"
 	"log"
@@ -34,12 +34,7 @@ func (h *UserHandler) HandleIsLiked(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userID, ok := session.Values["user_id"].(uint64)
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
+	userID := middleware.PrincipalFrom(r.Context()).UserID
 
 	isLiked, err := h.UserService.IsLiked(userID, uint64(essayId))
 	if err != nil {
@@ -62,7 +57,7 @@ func (h *UserHandler) HandleLikes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.UserService.GetEssayByID(uint64(id))
+	essay, err := h.UserService.GetEssayByID(uint64(id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.Printf("Failed to find essay with id %d: %v", id, err)
@@ -73,6 +68,10 @@ func (h *UserHandler) HandleLikes(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to find essay", http.StatusInternalServerError)
 		return
 	}
+	if essay.RemovedAt != nil {
+		http.Error(w, "Essay not found", http.StatusNotFound)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -86,12 +85,7 @@ func (h *UserHandler) HandleLikes(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(map[string]int{"likes": count})
 
 	case http.MethodPut:
-		session, _ := config.SessionStore.Get(r, "session")
-		userID, ok := session.Values["user_id"].(uint64)
-		if !ok {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
+		userID := middleware.PrincipalFrom(r.Context()).UserID
 
 		if isLiked, err := h.UserService.IsLiked(userID, uint64(id)); err != nil {
 			log.Print("Error with like: ", err)
@@ -135,7 +129,7 @@ func (h *UserHandler) HandleComments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.UserService.GetEssayByID(uint64(id))
+	essay, err := h.UserService.GetEssayByID(uint64(id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			log.Printf("Failed to find essay with id %d: %v", id, err)
@@ -146,6 +140,10 @@ func (h *UserHandler) HandleComments(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to find essay", http.StatusInternalServerError)
 		return
 	}
+	if essay.RemovedAt != nil {
+		http.Error(w, "Essay not found", http.StatusNotFound)
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -159,13 +157,7 @@ func (h *UserHandler) HandleComments(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(comments)
 
 	case http.MethodPost:
-		session, _ := config.SessionStore.Get(r, "session")
-		userIDInterface, ok := session.Values["user_id"]
-		if !ok {
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
-		}
-		userID := userIDInterface.(uint64)
+		userID := middleware.PrincipalFrom(r.Context()).UserID
 
 		var comment struct {
 			CommentText string `json:"comment_text"`
@@ -272,7 +264,8 @@ func (h *UserHandler) GetCounts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// CreateResult handles POST /result/id.
+// CreateResult handles POST /result/id. Only the checker may call it: requests
+// are signed, see middleware.SignatureVerifier.
 func (h *UserHandler) CreateResult(w http.ResponseWriter, r *http.Request) {
 	log.Print("POST ", r.URL.Path)
 	if r.Method != http.MethodPost {
@@ -289,34 +282,43 @@ func (h *UserHandler) CreateResult(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var request struct {
+		AttemptID   string                `json:"attempt_id"`
 		LLMResponse models.DetailedResult `json:"llm_response"`
 	}
 
-	log.Print("LLMResponse: ", request.LLMResponse)
-
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		log.Printf("Invalid request body: %v", err)
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	err = h.UserService.CreateResult(&request.LLMResponse, uint64(id))
+	err = h.UserService.SaveCheckResult(&models.CheckResult{
+		EssayID:     uint64(id),
+		AttemptID:   request.AttemptID,
+		LLMResponse: request.LLMResponse,
+	})
 	if err != nil {
-		log.Printf("Failed to create result: %v", err)
-		http.Error(w, "Failed to create result", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("Changing essay status to 'checked' for essayID %d", id)
-	if err := h.UserService.ChangeEssayStatus(uint64(id), "checked"); err != nil {
-		log.Printf("Failed to change essay status: %v", err)
-		http.Error(w, "Failed to change essay status", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Essay not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrWrongStatus):
+			log.Printf("Essay %d is not waiting for a check result", id)
+			http.Error(w, "Essay is not waiting for a check result", http.StatusConflict)
+		case errors.Is(err, services.ErrResultExists):
+			http.Error(w, "Result already exists", http.StatusConflict)
+		case errors.Is(err, services.ErrInvalidResult):
+			log.Printf("Rejected result for essay %d: %v", id, err)
+			writeValidationError(w, err)
+		default:
+			log.Printf("Failed to create result: %v", err)
+			http.Error(w, "Failed to create result", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	log.Printf("Result created successfully: %+v", request.LLMResponse)
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(request.LLMResponse)
 }
 
@@ -346,17 +348,22 @@ func (h *UserHandler) CreateAppealResult(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Save result
-	err = h.UserService.CreateResult(&result, essayID)
+	// Save result and update essay status through the open appeal of the essay
+	moderatorID := middleware.PrincipalFrom(r.Context()).UserID
+	appealID, err := h.UserService.GetOpenAppealID(essayID)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Essay is not under appeal", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to find appeal of essay %d: %v", essayID, err)
 		http.Error(w, "Failed to save result", http.StatusInternalServerError)
 		return
 	}
 
-	// Update essay status
-	err = h.UserService.ChangeEssayStatus(essayID, "appealed")
+	err = h.UserService.ResolveAppeal(appealID, moderatorID, &result, "")
 	if err != nil {
-		http.Error(w, "Failed to update essay status", http.StatusInternalServerError)
+		h.writeAppealError(w, appealID, err)
 		return
 	}
 
@@ -366,7 +373,8 @@ func (h *UserHandler) CreateAppealResult(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// GetCriteria handles GET /criteria
+// GetCriteria handles GET /criteria?variant_id=
+// Without variant_id the latest version of the default rubric is returned.
 func (h *UserHandler) GetCriteria(w http.ResponseWriter, r *http.Request) {
 	log.Println("GET ", r.URL.Path)
 	if r.Method != http.MethodGet {
@@ -374,7 +382,28 @@ func (h *UserHandler) GetCriteria(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	criteria, err := h.UserService.GetCriteria()
+	var variantID uint64
+	if v := r.URL.Query().Get("variant_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return
+		}
+		variantID = id
+	}
+
+	rubricVersionID, err := h.UserService.VariantRubricVersionID(variantID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Rubric not found", http.StatusNotFound)
+			return
+		}
+		log.Print("Error getting rubric version: ", err)
+		http.Error(w, "Error getting criteria:", http.StatusInternalServerError)
+		return
+	}
+
+	criteria, err := h.UserService.GetCriteria(rubricVersionID)
 	if err != nil {
 		log.Print("Error getting criteria: ", err)
 		http.Error(w, "Error getting criteria:", http.StatusInternalServerError)
@@ -393,12 +422,7 @@ func (h *UserHandler) GetUserResults(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userID, ok := session.Values["user_id"].(uint64)
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
+	userID := middleware.PrincipalFrom(r.Context()).UserID
 
 	results, err := h.UserService.GetResultsByUserID(userID)
 	if err != nil {
@@ -410,3 +434,20 @@ func (h *UserHandler) GetUserResults(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(results)
 }
+
+// writeValidationError responds 422 with the field errors of a rejected result.
+func writeValidationError(w http.ResponseWriter, err error) {
+	response := struct {
+		Error  string                `json:"error"`
+		Fields []services.FieldError `json:"fields,omitempty"`
+	}{Error: services.ErrInvalidResult.Error()}
+
+	var verr *services.ValidationError
+	if errors.As(err, &verr) {
+		response.Fields = verr.Fields
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"essay/src/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectEssayStatus(mock sqlmock.Sqlmock, essayID uint64, status string) {
+	mock.ExpectQuery(`SELECT status FROM essay WHERE id = \$1 FOR UPDATE`).
+		WithArgs(essayID).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(status))
+}
+
+func TestHandleLikes_RemovedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	removedAt := time.Now()
+	expectRemovedEssay(mock, 7, 2, "checked", &removedAt)
+
+	rec := httptest.NewRecorder()
+	handler.HandleLikes(rec, newSessionRequest(http.MethodPut, "/likes/7", 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleComments_RemovedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	removedAt := time.Now()
+	expectRemovedEssay(mock, 7, 2, "checked", &removedAt)
+
+	rec := httptest.NewRecorder()
+	handler.HandleComments(rec, newSessionRequestWithBody(http.MethodPost, "/comments/7", 1, false, `{"comment_text": "text"}`))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAppealResult_RequiresModerator(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	rec := serveRoute(handler, newSessionRequestWithBody(http.MethodPost, "/result/appeal/7", 1, false, `{}`))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAppealResult_RejectsEssayNotUnderAppeal(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`SELECT id FROM appeal`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	rec := httptest.NewRecorder()
+	handler.CreateAppealResult(rec, newSessionRequestWithBody(http.MethodPost, "/result/appeal/7", 3, true, `{"K1_score": 1}`))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAppealResult_RejectsAppealClaimedByAnother(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`SELECT id FROM appeal`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT essay_id, status, COALESCE\(moderator_id, 0\) FROM appeal WHERE id = \$1 FOR UPDATE`).
+		WithArgs(uint64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"essay_id", "status", "moderator_id"}).AddRow(7, "claimed", 4))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	handler.CreateAppealResult(rec, newSessionRequestWithBody(http.MethodPost, "/result/appeal/7", 3, true, `{"K1_score": 1}`))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleAppeal_RequiresModerator(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	rec := serveRoute(handler, newSessionRequestWithBody(http.MethodPost, "/appeals/2/claim", 1, false, ``))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleAppeal_ClaimConflict(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectExec(`UPDATE appeal SET status = 'claimed'`).
+		WithArgs(uint64(2), uint64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT status FROM appeal WHERE id = \$1`).
+		WithArgs(uint64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("claimed"))
+
+	rec := httptest.NewRecorder()
+	handler.HandleAppeal(rec, newSessionRequestWithBody(http.MethodPost, "/appeals/2/claim", 3, true, ``))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateResult_RejectsEssayNotSaved(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(uint64(7), "").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	expectEssayStatus(mock, 7, "draft")
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	handler.CreateResult(rec, newSessionRequestWithBody(http.MethodPost, "/result/7", 1, false, `{"llm_response": {"K1_score": 1}}`))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateResult_RejectsOutOfRangeScores(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT EXISTS`).
+		WithArgs(uint64(7), "a1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	expectEssayStatus(mock, 7, "saved")
+	mock.ExpectQuery(`SELECT rv.id, r.code`).
+		WithArgs(uint64(7), services.DefaultRubricCode).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ege"))
+	mock.ExpectQuery(`SELECT id, code, title, max_score FROM "criteria"`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "title", "max_score"}).
+			AddRow(1, "K1", "Позиция автора", 1).
+			AddRow(2, "K2", "Комментарий", 3))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	body := `{"attempt_id": "a1", "llm_response": {"K1_score": 7, "K2_score": -1}}`
+	handler.CreateResult(rec, newSessionRequestWithBody(http.MethodPost, "/result/7", 1, false, body))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	var response struct {
+		Fields []services.FieldError `json:"fields"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	if assert.Len(t, response.Fields, 2) {
+		assert.Equal(t, "K1", response.Fields[0].Field)
+		assert.Equal(t, "K2", response.Fields[1].Field)
+	}
+	// статус сочинения не меняется: транзакция откатывается до вставок и обновлений
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPublishRubricVersion_RequiresModerator(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	rec := serveRoute(handler, newSessionRequestWithBody(http.MethodPost, "/rubrics/ege/versions", 1, false, `{"criteria": []}`))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
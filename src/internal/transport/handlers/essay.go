@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -9,9 +8,8 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
-	"essay/src/internal/config"
+	"essay/src/internal/middleware"
 	"essay/src/internal/models"
 	"essay/src/internal/services"
 )
@@ -45,7 +43,16 @@ func (h *UserHandler) HandleEssayRequests(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if r.Method == http.MethodPut && (strings.HasSuffix(r.URL.Path, "/save") || strings.HasSuffix(r.URL.Path, "/appeal") || strings.HasSuffix(r.URL.Path, "/publish")) {
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/revise") {
+		h.ReviseEssay(w, r)
+		return
+	} else if r.Method == http.MethodPut && strings.HasSuffix(r.URL.Path, "/restore") {
+		h.RestoreEssay(w, r)
+		return
+	} else if r.Method == http.MethodDelete && len(parts) == 3 {
+		h.RemoveEssay(w, r)
+		return
+	} else if r.Method == http.MethodPut && (strings.HasSuffix(r.URL.Path, "/save") || strings.HasSuffix(r.URL.Path, "/appeal") || strings.HasSuffix(r.URL.Path, "/publish")) {
 		h.ChangeEssayStatus(w, r)
 		return
 	} else if r.Method == http.MethodPut {
@@ -77,14 +84,8 @@ func (h *UserHandler) GetAppealEssays(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	isModerator, ok := session.Values["is_moderator"].(bool)
-	if !ok || !isModerator {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	essays, err := h.UserService.GetAppealEssays()
+	moderatorID := middleware.PrincipalFrom(r.Context()).UserID
+	essays, err := h.UserService.GetAppealEssays(moderatorID)
 	if err != nil {
 		log.Printf("Error retrieving essays: %v", err)
 		http.Error(w, "Failed to retrieve essays", http.StatusInternalServerError)
@@ -121,6 +122,10 @@ func (h *UserHandler) GetEssayByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if essay.RemovedAt != nil {
+		http.Error(w, "Essay not found", http.StatusNotFound)
+		return
+	}
 	if !essay.IsPublished {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
@@ -153,14 +158,15 @@ func (h *UserHandler) GetUserEssays(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userID, ok := session.Values["user_id"].(uint64)
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
+	userID := middleware.PrincipalFrom(r.Context()).UserID
 
-	essays, err := h.UserService.GetUserEssays(userID)
+	var essays []models.EssayCard
+	var err error
+	if r.URL.Query().Get("removed") == "true" {
+		essays, err = h.UserService.GetRemovedEssays(userID)
+	} else {
+		essays, err = h.UserService.GetUserEssays(userID)
+	}
 	if err != nil {
 		log.Printf("Error retrieving user essays: %v", err)
 		http.Error(w, "Failed to retrieve user essays", http.StatusInternalServerError)
@@ -187,6 +193,23 @@ func (h *UserHandler) GetUserEssayByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if len(parts) == 6 && parts[5] == "history" {
+		h.GetEssayStatusHistory(w, r, uint64(id))
+		return
+	}
+	if len(parts) == 6 && parts[5] == "precheck" {
+		h.PrecheckEssay(w, r, uint64(id))
+		return
+	}
+	if len(parts) == 6 && parts[5] == "revisions" {
+		h.GetEssayRevisions(w, r, uint64(id))
+		return
+	}
+	if len(parts) >= 6 && parts[5] == "text-revisions" {
+		h.GetEssayTextRevisions(w, r, uint64(id), parts[6:])
+		return
+	}
+
 	essay, err := h.UserService.GetDetailedEssayByID(uint64(id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -198,22 +221,250 @@ func (h *UserHandler) GetUserEssayByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userIDInterface, ok := session.Values["user_id"]
-	if ok {
-		userID := userIDInterface.(uint64)
-		if essay.AuthorID != userID {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+	if p := middleware.PrincipalFrom(r.Context()); p.Authenticated() && essay.AuthorID != p.UserID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	essay.CheckAttempts, err = h.UserService.GetCheckAttempts(essay.ID)
+	if err != nil {
+		log.Printf("Error GetCheckAttempts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	essay.Appeal, err = h.UserService.GetAppealReview(essay.ID)
+	if err != nil {
+		log.Printf("Error GetAppealReview: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", formatETag(essay.Version))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(essay)
+}
+
+// ownEssay loads the essay of the session user. It writes the error response and
+// returns nil when the essay is missing or belongs to someone else.
+func (h *UserHandler) ownEssay(w http.ResponseWriter, r *http.Request, id uint64) *models.Essay {
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	essay, err := h.UserService.GetEssayByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Essay not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error GetEssayByID: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return nil
+	}
+	if essay.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	return essay
+}
+
+// GetEssayStatusHistory handles GET /users/me/essays/:id/history.
+func (h *UserHandler) GetEssayStatusHistory(w http.ResponseWriter, r *http.Request, id uint64) {
+	if h.ownEssay(w, r, id) == nil {
+		return
+	}
+
+	history, err := h.UserService.GetEssayStatusHistory(id)
+	if err != nil {
+		log.Printf("Error GetEssayStatusHistory: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// PrecheckEssay handles GET /users/me/essays/:id/precheck: word count, structure and
+// originality of the saved text, with the problems found.
+func (h *UserHandler) PrecheckEssay(w http.ResponseWriter, r *http.Request, id uint64) {
+	essay := h.ownEssay(w, r, id)
+	if essay == nil {
+		return
+	}
+
+	check, err := h.UserService.PrecheckUserEssay(essay)
+	if err != nil {
+		log.Printf("Error PrecheckUserEssay: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(check)
+}
+
+// GetEssayRevisions handles GET /users/me/essays/:id/revisions.
+func (h *UserHandler) GetEssayRevisions(w http.ResponseWriter, r *http.Request, id uint64) {
+	if h.ownEssay(w, r, id) == nil {
+		return
+	}
+
+	chain, err := h.UserService.GetRevisionChain(id)
+	if err != nil {
+		log.Printf("Error GetRevisionChain: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chain)
+}
+
+// GetEssayTextRevisions handles GET /users/me/essays/:id/text-revisions and
+// GET /users/me/essays/:id/text-revisions/:a/diff/:b.
+func (h *UserHandler) GetEssayTextRevisions(w http.ResponseWriter, r *http.Request, id uint64, rest []string) {
+	var a, b uint64
+	if len(rest) != 0 {
+		var errA, errB error
+		if len(rest) != 3 || rest[1] != "diff" {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return
+		}
+		a, errA = strconv.ParseUint(rest[0], 10, 64)
+		b, errB = strconv.ParseUint(rest[2], 10, 64)
+		if errA != nil || errB != nil {
+			http.Error(w, "Invalid revision ID", http.StatusBadRequest)
 			return
 		}
 	}
 
-	// var detailedEssay models.DetailedEssay
+	if h.ownEssay(w, r, id) == nil {
+		return
+	}
 
-	// detailedEssay = *essay
+	if len(rest) == 0 {
+		revisions, err := h.UserService.GetEssayRevisions(id)
+		if err != nil {
+			log.Printf("Error GetEssayRevisions: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(revisions)
+		return
+	}
+
+	diff, err := h.UserService.DiffEssayRevisions(id, a, b)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Revision not found", http.StatusNotFound)
+		} else {
+			log.Printf("Error DiffEssayRevisions: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(essay)
+	json.NewEncoder(w).Encode(diff)
+}
+
+// RemoveEssay handles DELETE /essays/:id: drafts are deleted, checked essays archived.
+func (h *UserHandler) RemoveEssay(w http.ResponseWriter, r *http.Request) {
+	log.Print("DELETE ", r.URL.Path)
+	id, err := strconv.ParseUint(strings.Split(r.URL.Path, "/")[2], 10, 64)
+	if err != nil {
+		log.Printf("Invalid essay ID: %v", err)
+		http.Error(w, "Invalid essay ID", http.StatusBadRequest)
+		return
+	}
+
+	essay := h.ownEssay(w, r, id)
+	if essay == nil {
+		return
+	}
+
+	state, err := h.UserService.RemoveEssay(essay)
+	if err != nil {
+		if errors.Is(err, services.ErrWrongStatus) {
+			log.Printf("Failed to remove essay with id %d: status is %s", id, essay.Status)
+			http.Error(w, "Essay is being checked or appealed, or already removed", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to remove essay with id %d: %v", id, err)
+		http.Error(w, "Failed to remove essay", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Essay %d %s", id, state)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"state": state})
+}
+
+// RestoreEssay handles PUT /essays/:id/restore.
+func (h *UserHandler) RestoreEssay(w http.ResponseWriter, r *http.Request) {
+	log.Print("PUT ", r.URL.Path)
+	id, err := strconv.ParseUint(strings.Split(r.URL.Path, "/")[2], 10, 64)
+	if err != nil {
+		log.Printf("Invalid essay ID: %v", err)
+		http.Error(w, "Invalid essay ID", http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	if err := h.UserService.RestoreEssay(id, userID); err != nil {
+		if errors.Is(err, services.ErrNotRestorable) {
+			http.Error(w, "Essay cannot be restored", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to restore essay with id %d: %v", id, err)
+		http.Error(w, "Failed to restore essay", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Essay %d restored", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReviseEssay handles POST /essays/:id/revise.
+func (h *UserHandler) ReviseEssay(w http.ResponseWriter, r *http.Request) {
+	log.Print("POST ", r.URL.Path)
+	parts := strings.Split(r.URL.Path, "/")
+	id, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		log.Printf("Invalid essay ID: %v", err)
+		http.Error(w, "Invalid essay ID", http.StatusBadRequest)
+		return
+	}
+
+	essay := h.ownEssay(w, r, id)
+	if essay == nil {
+		return
+	}
+	if essay.RemovedAt != nil {
+		log.Printf("Failed to revise essay with id %d: essay is removed", id)
+		http.Error(w, "Essay not found", http.StatusNotFound)
+		return
+	}
+
+	revisionID, err := h.UserService.ReviseEssay(essay)
+	if err != nil {
+		if errors.Is(err, services.ErrWrongStatus) {
+			log.Printf("Failed to revise essay with id %d: status is %s", id, essay.Status)
+			http.Error(w, "Only checked essays can be revised", http.StatusConflict)
+			return
+		}
+		log.Printf("Failed to revise essay with id %d: %v", id, err)
+		http.Error(w, "Failed to revise essay", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Essay %d revised as %d", id, revisionID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]uint64{"essay_id": revisionID, "parent_essay_id": id})
 }
 
 // CreateEssay handles POST /essays.
@@ -235,13 +486,7 @@ func (h *UserHandler) CreateEssay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userIDInterface, ok := session.Values["user_id"]
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-	userID := userIDInterface.(uint64)
+	userID := middleware.PrincipalFrom(r.Context()).UserID
 
 	var essay models.Essay
 	essay.Status = "draft"
@@ -257,10 +502,11 @@ func (h *UserHandler) CreateEssay(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Essay created successfully: %+v", essay)
-	w.WriteHeader(http.StatusCreated)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]int{
 		"essay_id": essayId,
+		"version":  1,
 	})
 }
 
@@ -276,57 +522,88 @@ func (h *UserHandler) UpdateEssay(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userIDInterface, ok := session.Values["user_id"]
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	var reqBody struct {
+		EssayText string `json:"essay_text"`
+		Version   *int   `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		log.Printf("Invalid request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	userID := userIDInterface.(uint64)
 
-	essay, err := h.UserService.GetEssayByID(uint64(id))
+	// версия берётся из If-Match, а если его нет — из тела запроса
+	version, err := parseETag(r.Header.Get("If-Match"))
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Printf("Failed to find essay with id %d: %v", id, err)
-			http.Error(w, "Failed to find essay", http.StatusBadRequest)
-			return
-		}
-		log.Printf("Failed to find essay with id %d: %v", id, err)
-		http.Error(w, "Failed to find essay", http.StatusInternalServerError)
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
 		return
 	}
-	if essay.UserID != userID {
-		log.Printf("Failed to save essay with id %d: wrong user ID", id)
-		http.Error(w, "Failed to save essay: wrong user ID", http.StatusForbidden)
+	if version == 0 && reqBody.Version != nil {
+		version = *reqBody.Version
+	}
+	if version == 0 {
+		http.Error(w, "Essay version is required: send If-Match or version", http.StatusPreconditionRequired)
 		return
 	}
 
-	var reqBody struct {
-		EssayText string `json:"essay_text"`
+	newEssay := models.Essay{
+		ID:        uint64(id),
+		EssayText: reqBody.EssayText,
+		UserID:    userID,
 	}
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		log.Printf("Invalid request body: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	var newEssay models.Essay
-	newEssay.ID = uint64(id)
-	newEssay.EssayText = reqBody.EssayText
-	newEssay.UserID = userID
 
-	log.Printf("Updating essay with id %d, text %s", newEssay.ID, newEssay.EssayText)
-	if err := h.UserService.UpdateEssay(&newEssay); err != nil {
-		if errors.Is(err, services.ErrWrongID) {
-			http.Error(w, "Wrong id", http.StatusBadRequest)
-			return
+	newVersion, err := h.UserService.UpdateEssay(&newEssay, version)
+	if err != nil {
+		var conflict *services.VersionConflictError
+		switch {
+		case errors.As(err, &conflict):
+			log.Printf("Stale version %d of essay %d, current is %d", version, id, conflict.Version)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", formatETag(conflict.Version))
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error":      "version_conflict",
+				"version":    conflict.Version,
+				"essay_text": conflict.EssayText,
+			})
+		case errors.Is(err, sql.ErrNoRows):
+			log.Printf("Failed to find essay with id %d: %v", id, err)
+			http.Error(w, "Essay not found", http.StatusNotFound)
+		case errors.Is(err, services.ErrWrongID):
+			log.Printf("Failed to save essay with id %d: wrong user ID", id)
+			http.Error(w, "Failed to save essay: wrong user ID", http.StatusForbidden)
+		case errors.Is(err, services.ErrExamTimeOver):
+			writeErrorCode(w, http.StatusForbidden, "exam_time_over", err)
+		case errors.Is(err, services.ErrWrongStatus):
+			log.Printf("Failed to save essay with id %d: not a draft", id)
+			http.Error(w, "Only drafts can be changed", http.StatusConflict)
+		default:
+			log.Printf("Failed to update essay: %v", err)
+			http.Error(w, "Failed to update essay", http.StatusInternalServerError)
 		}
-		log.Printf("Failed to update essay: %v", err)
-		http.Error(w, "Failed to update essay", http.StatusInternalServerError)
 		return
 	}
 
-	log.Print("Essay updated successfully")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", formatETag(newVersion))
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{"version": newVersion})
+}
+
+// formatETag renders an essay version as a strong ETag.
+func formatETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseETag reads an essay version from an If-Match value. An empty value gives 0.
+func parseETag(value string) (int, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(strings.Trim(value, `"`))
 }
 
 // ChangeEssayStatus handles PUT /essays/:id/<action>.
@@ -347,13 +624,7 @@ func (h *UserHandler) ChangeEssayStatus(w http.ResponseWriter, r *http.Request)
 	}
 	action := parts[3]
 
-	session, _ := config.SessionStore.Get(r, "session")
-	userIDInterface, ok := session.Values["user_id"]
-	if !ok {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-	userID := userIDInterface.(uint64)
+	userID := middleware.PrincipalFrom(r.Context()).UserID
 
 	essay, err := h.UserService.GetEssayByID(uint64(id))
 	if err != nil {
@@ -371,83 +642,63 @@ func (h *UserHandler) ChangeEssayStatus(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to save essay: wrong user ID", http.StatusForbidden)
 		return
 	}
-
-	var status string
+	// удалённое или архивное сочинение нельзя проверить, обжаловать или опубликовать
+	if essay.RemovedAt != nil {
+		log.Printf("Failed to set status %s to essay with id %d: essay is removed", action, id)
+		http.Error(w, "Essay not found", http.StatusNotFound)
+		return
+	}
 
 	switch action {
 	case "save":
-		if essay.Status != "draft" {
+		if !services.CanTransition(essay.Status, services.StatusSaved) {
 			log.Printf("Failed to save essay with id %d: status should be draft but it is %s", id, essay.Status)
 			http.Error(w, "Failed to save essay: status should be draft", http.StatusBadRequest)
 			return
 		}
 
-		// check count verification
-		err = h.UserService.DecreaseCheckCount(userID)
+		// списание проверки, смена статуса и постановка в очередь в одной транзакции
+		check, err := h.UserService.SubmitEssayForCheck(essay)
 		if err != nil {
+			if errors.Is(err, services.ErrEmailNotVerified) {
+				writeErrorCode(w, http.StatusForbidden, "email_not_verified", err)
+				return
+			}
 			if errors.Is(err, services.ErrNoChecksLeft) {
 				log.Printf("Failed to save essay with id %d: no checks left", id)
 				http.Error(w, "No checks left", http.StatusNotFound)
 				return
 			}
-			log.Printf("Failed to decrease check count: %v", err)
-			http.Error(w, "Failed to decrease check count", http.StatusInternalServerError)
-			return
-		}
-
-		status = "saved"
-		log.Printf("Essay ID %d enqueued for checking", id)
-		log.Printf("Changing essay status to '%s' for essayID %d", status, id)
-		if err := h.UserService.ChangeEssayStatus(uint64(id), status); err != nil {
-			log.Printf("Failed to change essay status: %v", err)
-			http.Error(w, "Failed to change essay status", http.StatusInternalServerError)
-			return
-		}
-
-		vaiant, err := h.UserService.GetVariantByID(essay.VariantID)
-		if err != nil {
-			log.Printf("Failed to get variant in ChangeEssayStatus: %v", err)
-			http.Error(w, "Failed to get variant in ChangeEssayStatus", http.StatusInternalServerError)
-			return
-		}
-		requestBody, err := json.Marshal(models.EssayRequest{
-			EssayID:        essay.ID,
-			EssayText:      essay.EssayText,
-			VariantText:    vaiant.VariantText,
-			AuthorPosition: vaiant.AuthorPosition,
-		})
-		if err != nil {
-			log.Printf("Failed to marshal JSON in ChangeEssayStatus: %v", err)
-			http.Error(w, "Failed to marshal JSON in ChangeEssayStatus", http.StatusInternalServerError)
+			if errors.Is(err, services.ErrWrongStatus) {
+				log.Printf("Failed to save essay with id %d: status changed concurrently", id)
+				http.Error(w, "Failed to save essay: status should be draft", http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to submit essay %d for checking: %v", id, err)
+			http.Error(w, "Failed to submit essay for checking", http.StatusInternalServerError)
 			return
 		}
 
-		client := &http.Client{Timeout: 60 * time.Second}
-		resp, err := client.Post(config.URL, "application/json", bytes.NewBuffer(requestBody))
-		if err != nil {
-			log.Printf("Failed to send request to Python service: %v", err)
-			http.Error(w, "Failed to send request to Python service", http.StatusInternalServerError)
-		}
-		defer resp.Body.Close()
-
-		log.Printf("Send to Python service")
-
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("Error from Python service: %s", resp.Status)
-			http.Error(w, "Error from Python service", http.StatusInternalServerError)
+		w.Header().Set("Content-Type", "application/json")
+		if !check.Passed {
+			// сочинение сразу получило 0 баллов, проверка не списана
+			log.Printf("Essay ID %d failed the precheck", id)
+			w.WriteHeader(http.StatusOK)
+		} else {
+			log.Printf("Essay ID %d enqueued for checking", id)
+			w.WriteHeader(http.StatusAccepted)
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(check)
 		return
 	case "appeal":
-		if essay.Status != "checked" {
+		if !services.CanTransition(essay.Status, services.StatusAppeal) {
 			log.Printf("Failed to file appeal for essay with id %d: status should be checked but it is %s", id, essay.Status)
 			http.Error(w, "Failed to file appeal for essay: status should be checked", http.StatusBadRequest)
 			return
 		}
-		status = "appeal"
-
 		var reqBody struct {
-			AppealText string `json:"appeal_text"`
+			AppealText string                   `json:"appeal_text"`
+			Criteria   []models.AppealCriterion `json:"criteria"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 			log.Printf("Invalid request body for appeal: %v", err)
@@ -455,16 +706,33 @@ func (h *UserHandler) ChangeEssayStatus(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		if err := h.UserService.UnpublishEssay(uint64(id), userID); err != nil {
-			log.Printf("Failed to unpublish essay: %v", err)
-			http.Error(w, "Failed to unpublish essay", http.StatusInternalServerError)
-			return
-		}
-		if err := h.UserService.SetAppealText(uint64(id), reqBody.AppealText); err != nil {
-			log.Printf("Failed to set appeal text: %v", err)
-			http.Error(w, "Failed to set appeal text", http.StatusInternalServerError)
+		// смена статуса, снятие с публикации и создание апелляции в одной транзакции
+		appealID, err := h.UserService.FileAppeal(essay, reqBody.AppealText, reqBody.Criteria)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrWrongStatus):
+				log.Printf("Failed to file appeal for essay with id %d: %v", id, err)
+				http.Error(w, "Essay status changed concurrently", http.StatusConflict)
+			case errors.Is(err, services.ErrInvalidAppeal):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case errors.Is(err, services.ErrAppealExists):
+				writeErrorCode(w, http.StatusConflict, "appeal_exists", err)
+			case errors.Is(err, services.ErrAppealWindowClosed):
+				writeErrorCode(w, http.StatusForbidden, "appeal_window_closed", err)
+			case errors.Is(err, services.ErrAppealQuotaExceeded):
+				writeErrorCode(w, http.StatusTooManyRequests, "appeal_quota_exceeded", err)
+			default:
+				log.Printf("Failed to file appeal for essay with id %d: %v", id, err)
+				http.Error(w, "Failed to file appeal", http.StatusInternalServerError)
+			}
 			return
 		}
+
+		log.Printf("Appeal %d filed for essay %d", appealID, id)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]uint64{"appeal_id": appealID})
+		return
 	case "publish":
 		log.Printf("Publishing essay: ID %d", id)
 		if err := h.UserService.PublishEssay(uint64(id), userID); err != nil {
@@ -480,14 +748,4 @@ func (h *UserHandler) ChangeEssayStatus(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid action", http.StatusBadRequest)
 		return
 	}
-
-	log.Printf("Changing essay status to '%s' for essayID %d", status, id)
-	if err := h.UserService.ChangeEssayStatus(uint64(id), status); err != nil {
-		log.Printf("Failed to change essay status: %v", err)
-		http.Error(w, "Failed to change essay status", http.StatusInternalServerError)
-		return
-	}
-
-	log.Print("Essay status changed successfully")
-	w.WriteHeader(http.StatusOK)
 }
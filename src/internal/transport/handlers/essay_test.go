@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"encoding/json"
+	"essay/src/internal/config"
+	"essay/src/internal/middleware"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newSessionRequest builds a request carrying a session cookie for userID.
+func newSessionRequest(method, path string, userID uint64) *http.Request {
+	return newSessionRequestWithBody(method, path, userID, false, "")
+}
+
+func newSessionRequestWithBody(method, path string, userID uint64, isModerator bool, body string) *http.Request {
+	config.InitSessionStore()
+
+	req := httptest.NewRequest(method, path, nil)
+	rec := httptest.NewRecorder()
+	session, _ := config.SessionStore.New(req, "session")
+	session.Values["user_id"] = userID
+	session.Values["is_moderator"] = isModerator
+	session.Save(req, rec)
+
+	req = httptest.NewRequest(method, path, strings.NewReader(body))
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	// обработчики, вызванные напрямую, получают пользователя так же, как после Authenticate
+	principal := &middleware.Principal{UserID: userID, IsModerator: isModerator}
+	return req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+}
+
+var testTokenKey = []byte("test token key")
+
+// serveRoute passes the request through the routes of handler with authentication
+// and role checks, as the server does.
+func serveRoute(handler *UserHandler, req *http.Request) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	handler.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	middleware.Authenticate(config.SessionStore, testTokenKey)(mux).ServeHTTP(rec, req)
+	return rec
+}
+
+// essayText passes the precheck: 240 Cyrillic words in four paragraphs.
+var essayText = strings.TrimSuffix(strings.Repeat(strings.Repeat("Книги учат нас думать и сопереживать. ", 10)+"\n", 4), "\n")
+
+func expectEssay(mock sqlmock.Sqlmock, essayID, userID uint64, status string) {
+	expectRemovedEssay(mock, essayID, userID, status, nil)
+}
+
+func expectRemovedEssay(mock sqlmock.Sqlmock, essayID, userID uint64, status string, removedAt *time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, essay_text, completed_at, status, is_published, user_id, variant_id, COALESCE(deleted_at, archived_at) FROM essay WHERE id = $1`)).
+		WithArgs(essayID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text", "completed_at", "status", "is_published", "user_id", "variant_id", "removed_at"}).
+			AddRow(essayID, essayText, time.Now(), status, false, userID, 1, removedAt))
+}
+
+func expectEmailVerified(mock sqlmock.Sqlmock, userID uint64, verified bool) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT email_verified FROM "user" WHERE id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"email_verified"}).AddRow(verified))
+}
+
+func expectPrecheckVariant(mock sqlmock.Sqlmock, variantID uint64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(variant_text, '') FROM variant WHERE id = $1`)).
+		WithArgs(variantID).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text"}).AddRow("Variant text"))
+}
+
+func TestChangeEssayStatus_SaveEnqueuesEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	expectEssay(mock, 7, 1, "draft")
+	expectEmailVerified(mock, 1, true)
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE essay SET status = $1 WHERE id = $2 AND status = $3`)).
+		WithArgs(services.StatusSaved, uint64(7), services.StatusDraft).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`INSERT INTO essay_status_history`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`UPDATE exam_session SET status`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT variant_text, COALESCE(author_position, '') FROM variant WHERE id = $1`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"variant_text", "author_position"}).AddRow("Variant text", "Position"))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO check_attempt (essay_id, attempt_id, attempt_number) VALUES ($1, $2, $3)`)).
+		WithArgs(uint64(7), sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO outbox (essay_id, payload) VALUES ($1, $2)`)).
+		WithArgs(uint64(7), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	handler.ChangeEssayStatus(rec, newSessionRequest(http.MethodPut, "/essays/7/save", 1))
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeEssayStatus_SaveWithoutChecks(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	expectEssay(mock, 7, 1, "draft")
+	expectEmailVerified(mock, 1, true)
+	mock.ExpectBegin()
+	expectPrecheckVariant(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "user" SET count_checks = count_checks - 1 WHERE id = $1 AND count_checks > 0`)).
+		WithArgs(uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	handler.ChangeEssayStatus(rec, newSessionRequest(http.MethodPut, "/essays/7/save", 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeEssayStatus_SaveUnverifiedEmail(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	// без подтверждённой почты проверка не списывается и транзакция не начинается
+	expectEssay(mock, 7, 1, "draft")
+	expectEmailVerified(mock, 1, false)
+
+	rec := httptest.NewRecorder()
+	handler.ChangeEssayStatus(rec, newSessionRequest(http.MethodPut, "/essays/7/save", 1))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"email_not_verified"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeEssayStatus_RemovedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	deletedAt := time.Now().Add(-time.Hour)
+
+	for _, action := range []string{"save", "publish"} {
+		expectRemovedEssay(mock, 7, 1, "draft", &deletedAt)
+
+		rec := httptest.NewRecorder()
+		handler.ChangeEssayStatus(rec, newSessionRequest(http.MethodPut, "/essays/7/"+action, 1))
+
+		// проверка не списывается и сочинение не ставится в очередь
+		assert.Equal(t, http.StatusNotFound, rec.Code, action)
+	}
+
+	archivedAt := time.Now().Add(-time.Hour)
+	expectRemovedEssay(mock, 7, 1, "checked", &archivedAt)
+	rec := httptest.NewRecorder()
+	handler.ChangeEssayStatus(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7/appeal", 1, false, `{"appeal_text": "text"}`))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_RemovedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`UPDATE essay SET essay_text[\s\S]+AND deleted_at IS NULL AND archived_at IS NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version[\s\S]+FROM essay WHERE id = \$1 AND deleted_at IS NULL AND archived_at IS NULL`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "new", "version": 3}`))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEssayStatusHistory(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "checked")
+	mock.ExpectQuery(`SELECT from_status, to_status, actor`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"from_status", "to_status", "actor", "actor_id", "reason", "created_at"}).
+			AddRow("draft", "saved", "user", 1, "submitted for check", time.Now()).
+			AddRow("saved", "checked", "checker", 0, "check result a1", time.Now()))
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/7/history", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var history []models.EssayStatusChange
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&history))
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "checked", history[1].To)
+		assert.Equal(t, services.ActorChecker, history[1].Actor.Kind)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEssayStatusHistory_OtherUser(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "checked")
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/7/history", 2))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`INSERT INTO essay \(essay_text, completed_at, status, is_published, user_id, variant_id\)`).
+		WithArgs("text", sqlmock.AnyArg(), services.StatusDraft, false, uint64(1), uint64(4)).
+		WillReturnRows(sqlmock.NewRows([]string{"essay_id"}).AddRow(7))
+
+	rec := httptest.NewRecorder()
+	handler.CreateEssay(rec, newSessionRequestWithBody(http.MethodPost, "/essays", 1, false, `{"essay_text": "text", "variant_id": 4}`))
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var response map[string]int
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, 7, response["essay_id"])
+	assert.Equal(t, 1, response["version"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviseEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "checked")
+	mock.ExpectQuery(`INSERT INTO essay \(essay_text, completed_at, status, is_published, user_id, variant_id, parent_essay_id\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), services.StatusDraft, uint64(1), sqlmock.AnyArg(), uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodPost, "/essays/7/revise", 1))
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response map[string]uint64
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, uint64(8), response["essay_id"])
+	assert.Equal(t, uint64(7), response["parent_essay_id"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviseEssay_NotChecked(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "saved")
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodPost, "/essays/7/revise", 1))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviseEssay_RemovedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	removedAt := time.Now()
+	expectRemovedEssay(mock, 7, 1, "checked", &removedAt)
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodPost, "/essays/7/revise", 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReviseEssay_OtherUser(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "checked")
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodPost, "/essays/7/revise", 2))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEssayRevisions(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 8, 1, "draft")
+	mock.ExpectQuery(`WITH RECURSIVE up AS`).
+		WithArgs(uint64(8)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent_essay_id", "status", "completed_at", "sum_score", "criteria_id", "code", "title", "score"}).
+			AddRow(7, nil, services.StatusChecked, time.Now(), 3, 1, "K1", "Позиция автора", 1).
+			AddRow(8, 7, services.StatusDraft, time.Now(), nil, nil, nil, nil, nil))
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/8/revisions", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var chain []models.EssayRevision
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&chain))
+	if assert.Len(t, chain, 2) {
+		assert.Equal(t, uint64(7), *chain[1].ParentEssayID)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEssayRevisionDiff(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "draft")
+	mock.ExpectQuery(`FROM essay_revision r`).
+		WithArgs(uint64(7), uint64(3), uint64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text"}).
+			AddRow(3, "Автор поднимает проблему").
+			AddRow(5, "Автор поднимает важную проблему"))
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/7/text-revisions/3/diff/5", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var diff models.TextDiff
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&diff))
+	assert.Equal(t, []models.TextChange{{Op: services.DiffInsert, Offset: 16, Length: 6, Text: "важную"}}, diff.Changes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetEssayRevisionDiff_OtherChain(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "draft")
+	mock.ExpectQuery(`FROM essay_revision r`).
+		WithArgs(uint64(7), uint64(3), uint64(99)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "essay_text"}).AddRow(3, "Автор поднимает проблему"))
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/7/text-revisions/3/diff/99", 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_RequiresVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "new"}`))
+
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_IfMatch(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`UPDATE essay SET essay_text = \$1, version = version \+ 1`).
+		WithArgs("new", uint64(7), uint64(1), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+
+	req := newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "new"}`)
+	req.Header.Set("If-Match", `"3"`)
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_StaleVersion(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`UPDATE essay SET essay_text`).
+		WithArgs("new", uint64(7), uint64(1), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(1, 5, "text from another tab", false, "draft"))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "new", "version": 3}`))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	var response struct {
+		Error     string `json:"error"`
+		Version   int    `json:"version"`
+		EssayText string `json:"essay_text"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, "version_conflict", response.Error)
+	assert.Equal(t, 5, response.Version)
+	assert.Equal(t, "text from another tab", response.EssayText)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveEssay_ArchivesCheckedEssay(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "checked")
+	mock.ExpectExec(`UPDATE essay e SET archived_at = NOW\(\)`).
+		WithArgs(uint64(7), "checked").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodDelete, "/essays/7", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"state": "archived"}`, rec.Body.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveEssay_InCheck(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "saved")
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequest(http.MethodDelete, "/essays/7", 1))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_ExamTimeOver(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`UPDATE essay SET essay_text`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(1, 3, "exam text", true, "draft"))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "late", "version": 3}`))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"exam_time_over"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateEssay_NotDraft(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectQuery(`UPDATE essay SET essay_text`).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}))
+	mock.ExpectQuery(`SELECT user_id, version, COALESCE\(essay_text, ''\),\s+EXISTS\(SELECT 1 FROM exam_session`).
+		WithArgs(uint64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "version", "essay_text", "exam_over", "status"}).AddRow(1, 3, "checked text", false, services.StatusSaved))
+
+	rec := httptest.NewRecorder()
+	handler.HandleEssayRequests(rec, newSessionRequestWithBody(http.MethodPut, "/essays/7", 1, false, `{"essay_text": "new", "version": 3}`))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleExamSessions_InProgress(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count_checks, email_verified FROM "user" WHERE id = $1 FOR UPDATE`)).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"count_checks", "email_verified"}).AddRow(1, true))
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM exam_session WHERE user_id = \$1`).
+		WithArgs(uint64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	handler.HandleExamSessions(rec, newSessionRequestWithBody(http.MethodPost, "/exam-sessions", 1, false, ``))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"exam_in_progress"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleExamSession_OtherUser(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, user_id, essay_id, variant_id, status, started_at, deadline_at, ended_at FROM exam_session WHERE id = \$1`).
+		WithArgs(uint64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "essay_id", "variant_id", "status", "started_at", "deadline_at", "ended_at"}).
+			AddRow(3, 2, 9, 4, services.ExamActive, now, now.Add(time.Hour), nil))
+	mock.ExpectQuery(`SELECT version, essay_text, created_at FROM essay_revision`).
+		WithArgs(uint64(9), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "essay_text", "created_at"}))
+
+	rec := httptest.NewRecorder()
+	handler.HandleExamSession(rec, newSessionRequest(http.MethodGet, "/exam-sessions/3", 1))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPrecheckEssay_Passing(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	expectEssay(mock, 7, 1, "draft")
+	expectPrecheckVariant(mock, 1)
+
+	rec := httptest.NewRecorder()
+	handler.GetUserEssayByID(rec, newSessionRequest(http.MethodGet, "/users/me/essays/7/precheck", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var check models.Precheck
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&check))
+	assert.True(t, check.Passed)
+	assert.Equal(t, 240, check.Words)
+	assert.Empty(t, check.Warnings)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
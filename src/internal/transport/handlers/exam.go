@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"essay/src/internal/middleware"
+	"essay/src/internal/services"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HandleExamSessions handles GET /exam-sessions (sessions of the user) and
+// POST /exam-sessions ({variant_id}, a random variant when omitted).
+func (h *UserHandler) HandleExamSessions(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	switch r.Method {
+	case http.MethodGet:
+		sessions, err := h.UserService.GetExamSessions(userID)
+		if err != nil {
+			log.Printf("Failed to get exam sessions of user %d: %v", userID, err)
+			http.Error(w, "Failed to get exam sessions", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	case http.MethodPost:
+		var reqBody struct {
+			VariantID uint64 `json:"variant_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		exam, err := h.UserService.StartExamSession(userID, reqBody.VariantID)
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrWrongID):
+				http.Error(w, "Variant not found", http.StatusNotFound)
+			case errors.Is(err, services.ErrEmailNotVerified):
+				writeErrorCode(w, http.StatusForbidden, "email_not_verified", err)
+			case errors.Is(err, services.ErrNoChecksLeft):
+				http.Error(w, "No checks left", http.StatusForbidden)
+			case errors.Is(err, services.ErrExamInProgress):
+				writeErrorCode(w, http.StatusConflict, "exam_in_progress", err)
+			default:
+				log.Printf("Failed to start exam session for user %d: %v", userID, err)
+				http.Error(w, "Failed to start exam session", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		log.Printf("Exam session %d started: essay %d, variant %d", exam.ID, exam.EssayID, exam.VariantID)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(exam)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleExamSession handles GET /exam-sessions/{id}: the session of the user with its
+// autosaved snapshots.
+func (h *UserHandler) HandleExamSession(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/exam-sessions/"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid exam session ID", http.StatusBadRequest)
+		return
+	}
+
+	exam, err := h.UserService.GetExamSession(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Exam session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to get exam session %d: %v", id, err)
+		http.Error(w, "Failed to get exam session", http.StatusInternalServerError)
+		return
+	}
+	if exam.UserID != userID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(exam)
+}
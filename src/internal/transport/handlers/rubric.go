@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GetRubrics handles GET /rubrics
+func (h *UserHandler) GetRubrics(w http.ResponseWriter, r *http.Request) {
+	log.Println("GET ", r.URL.Path)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rubrics, err := h.UserService.GetRubrics()
+	if err != nil {
+		log.Print("Error getting rubrics: ", err)
+		http.Error(w, "Error getting rubrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rubrics)
+}
+
+// HandleRubric handles
+// GET /rubrics/{code} (latest version),
+// GET /rubrics/{code}/versions/{version},
+// POST /rubrics/{code}/versions (moderator publishes a new version)
+func (h *UserHandler) HandleRubric(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[1] == "" || len(parts) > 4 || (len(parts) > 2 && parts[2] != "versions") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	code := parts[1]
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 2:
+		h.getRubricVersion(w, code, 0)
+	case r.Method == http.MethodGet && len(parts) == 4:
+		version, err := strconv.Atoi(parts[3])
+		if err != nil || version <= 0 {
+			http.Error(w, "Invalid rubric version", http.StatusBadRequest)
+			return
+		}
+		h.getRubricVersion(w, code, version)
+	case r.Method == http.MethodPost && len(parts) == 3:
+		h.publishRubricVersion(w, r, code)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *UserHandler) getRubricVersion(w http.ResponseWriter, code string, version int) {
+	rubricVersion, err := h.UserService.GetRubricVersion(code, version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Rubric not found", http.StatusNotFound)
+			return
+		}
+		log.Print("Error getting rubric: ", err)
+		http.Error(w, "Error getting rubric", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rubricVersion)
+}
+
+func (h *UserHandler) publishRubricVersion(w http.ResponseWriter, r *http.Request, code string) {
+	var req struct {
+		Title    string            `json:"title"`
+		Criteria []models.Criteria `json:"criteria"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rubricVersion, err := h.UserService.PublishRubricVersion(code, req.Title, req.Criteria)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRubric) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Failed to publish rubric %s: %v", code, err)
+		http.Error(w, "Failed to publish rubric", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rubricVersion)
+}
@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"essay/src/internal/config"
+	"essay/src/internal/middleware"
 	"essay/src/internal/models"
 	"essay/src/internal/services"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func (h *UserHandler) GetNickname(w http.ResponseWriter, r *http.Request) {
@@ -73,8 +76,10 @@ func (h *UserHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	session, _ := config.SessionStore.Get(r, "session")
+	session.ID = "" // после входа сессия получает новый идентификатор
 	session.Values["user_id"] = user.ID
 	session.Values["is_moderator"] = user.IsModerator
+	session.Values["is_admin"] = user.IsAdmin
 	err = session.Save(r, w)
 	if err != nil {
 		log.Printf("Error saving session: %v\n", err)
@@ -93,6 +98,7 @@ func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 	session, _ := config.SessionStore.Get(r, "session")
 	delete(session.Values, "user_id")
 	delete(session.Values, "is_moderator")
+	delete(session.Values, "is_admin")
 	session.Options.MaxAge = -1
 	session.Save(r, w)
 	w.WriteHeader(http.StatusOK)
@@ -102,14 +108,7 @@ func (h *UserHandler) HandleLogout(w http.ResponseWriter, r *http.Request) {
 func (h *UserHandler) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
 	log.Println("GET ", r.URL.Path)
 
-	session, _ := config.SessionStore.Get(r, "session")
-	id, ok := session.Values["user_id"].(uint64)
-	log.Print("session: ", session)
-	if !ok {
-		log.Printf("Unauthorized")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	id := middleware.PrincipalFrom(r.Context()).UserID
 
 	// log.Printf("Fetching user with ID: %d\n", id)
 	user, err := h.UserService.GetUserInfoByID(id)
@@ -125,6 +124,13 @@ func (h *UserHandler) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user.RemainingAppeals, err = h.UserService.GetRemainingAppeals(id)
+	if err != nil {
+		log.Printf("Error fetching remaining appeals of user %d: %v\n", id, err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	// log.Printf("Successfully fetched user with ID %d\n", id)
@@ -160,6 +166,10 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	err = h.UserService.CreateUser(&user)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, services.ErrDuplicateEmail) {
 			log.Print("Email already in use")
 			http.Error(w, "Email already in use", http.StatusBadRequest)
@@ -181,8 +191,10 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	session, _ := config.SessionStore.Get(r, "session")
+	session.ID = ""
 	session.Values["user_id"] = created_user.ID
 	session.Values["is_moderator"] = created_user.IsModerator
+	session.Values["is_admin"] = created_user.IsAdmin
 	err = session.Save(r, w)
 	if err != nil {
 		log.Printf("Error saving session: %v\n", err)
@@ -207,16 +219,14 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, _ := config.SessionStore.Get(r, "session")
-	id, ok := session.Values["user_id"].(uint64)
-	if !ok {
-		log.Printf("Unauthorized")
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	id := middleware.PrincipalFrom(r.Context()).UserID
 
 	err = h.UserService.UpdateUser(userData.Mail, userData.Nickname, id)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmail) {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, services.ErrDuplicateEmail) {
 			log.Print("Email already in use")
 			http.Error(w, "Email already in use", http.StatusBadRequest)
@@ -230,3 +240,92 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintf(w, "Info changed successfully")
 }
+
+// HandleUserSessions handles GET /users/me/sessions: signed-in devices of the user.
+func (h *UserHandler) HandleUserSessions(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	userSessions, err := h.UserService.GetUserSessions(userID, middleware.PrincipalFrom(r.Context()).SessionID)
+	if err != nil {
+		log.Printf("Error fetching sessions of user %d: %v", userID, err)
+		http.Error(w, "Error fetching sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userSessions)
+}
+
+// HandleUserSession handles DELETE /users/me/sessions/{id}: signs the device out.
+func (h *UserHandler) HandleUserSession(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/users/me/sessions/"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.UserService.RevokeSession(userID, id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error revoking session %d of user %d: %v", id, userID, err)
+		http.Error(w, "Error revoking session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword handles PUT /users/me/password ({old_password, new_password}). All
+// other sessions of the user are signed out.
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.URL.Path)
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := middleware.PrincipalFrom(r.Context()).UserID
+
+	var reqBody struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if reqBody.NewPassword == "" {
+		http.Error(w, "New password is required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.UserService.ChangePassword(userID, reqBody.OldPassword, reqBody.NewPassword,
+		middleware.PrincipalFrom(r.Context()).SessionID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			http.Error(w, "Invalid credentials", http.StatusForbidden)
+			return
+		}
+		log.Printf("Error changing password of user %d: %v", userID, err)
+		http.Error(w, "Error changing password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
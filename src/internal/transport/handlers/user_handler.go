@@ -1,46 +1,96 @@
 package handlers
 
 import (
+	"essay/src/internal/middleware"
 	"essay/src/internal/services"
 	"net/http"
 )
 
 type UserHandler struct {
-	UserService *services.UserService
+	UserService       *services.UserService
+	SignatureVerifier *middleware.SignatureVerifier
 }
 
-func NewUserHandler(userService *services.UserService) *UserHandler {
+func NewUserHandler(userService *services.UserService, signatureVerifier *middleware.SignatureVerifier) *UserHandler {
 	return &UserHandler{
-		UserService: userService,
+		UserService:       userService,
+		SignatureVerifier: signatureVerifier,
+	}
+}
+
+// Route is a handler with the role required to call it.
+type Route struct {
+	Pattern string
+	Policy  middleware.Policy
+	Handler http.HandlerFunc
+}
+
+var (
+	anonymous = middleware.Only(middleware.RoleAnonymous)
+	user      = middleware.Only(middleware.RoleUser)
+	moderator = middleware.Only(middleware.RoleModerator)
+	admin     = middleware.Only(middleware.RoleAdmin)
+	service   = middleware.Only(middleware.RoleService)
+	// читать могут все, менять — только вошедшие пользователи
+	publicRead = middleware.ReadWrite(middleware.RoleAnonymous, middleware.RoleUser)
+)
+
+func (h *UserHandler) Routes() []Route {
+	return []Route{
+		// user
+		{"/users/nickname", anonymous, h.GetNickname},
+		{"/users/login", anonymous, h.HandleLogin},
+		{"/users/logout", anonymous, h.HandleLogout},
+		{"/users/info", user, h.HandleUserInfo},
+		{"/users/me/sessions", user, h.HandleUserSessions},
+		{"/users/me/sessions/", user, h.HandleUserSession},
+		{"/users/me/password", user, h.ChangePassword},
+		{"/users/me/verify-email", user, h.ResendVerification},
+		{"/users/verify-email", anonymous, h.VerifyEmail},
+		{"/users/password-reset", anonymous, h.RequestPasswordReset},
+		{"/users/password-reset/confirm", anonymous, h.ResetPassword},
+		// регистрация открыта всем, изменение данных — только себе
+		{"/users", middleware.Policy{Role: middleware.RoleUser, Methods: map[string]middleware.Role{
+			http.MethodPost: middleware.RoleAnonymous,
+		}}, h.HandleUser},
+		{"/auth/token", anonymous, h.IssueToken},
+		{"/auth/revoke", anonymous, h.RevokeToken},
+
+		// content
+		{"/counts/", anonymous, h.GetCounts},
+		{"/likes/is_liked/", user, h.HandleIsLiked},
+		{"/likes/", publicRead, h.HandleLikes},
+		{"/comments/", publicRead, h.HandleComments},
+		{"/variants", admin, h.CreateVariant},
+		{"/variants/", anonymous, h.GetVariant},
+		{"/criteria", anonymous, h.GetCriteria},
+		{"/rubrics", anonymous, h.GetRubrics},
+		{"/rubrics/", middleware.ReadWrite(middleware.RoleAnonymous, middleware.RoleModerator), h.HandleRubric},
+
+		// result
+		{"/result/", service, h.CreateResult},
+		{"/result/appeal/", moderator, h.CreateAppealResult},
+		{"/users/me/results", user, h.GetUserResults},
+
+		// essay
+		{"/essays", publicRead, h.HandleEssaysRequests},
+		{"/essays/", publicRead, h.HandleEssayRequests},
+		{"/essays/appeal", moderator, h.GetAppealEssays},
+		{"/appeals/", moderator, h.HandleAppeal},
+		{"/users/me/essays", user, h.GetUserEssays},
+		{"/users/me/essays/", user, h.GetUserEssayByID},
+		{"/exam-sessions", user, h.HandleExamSessions},
+		{"/exam-sessions/", user, h.HandleExamSession},
 	}
 }
 
 func (h *UserHandler) RegisterRoutes(mux *http.ServeMux) {
-	// user
-	mux.HandleFunc("/users/nickname", h.GetNickname)
-	mux.HandleFunc("/users/login", h.HandleLogin)
-	mux.HandleFunc("/users/logout", h.HandleLogout)
-	mux.HandleFunc("/users/info", h.HandleUserInfo)
-	mux.HandleFunc("/users", h.HandleUser)
-
-	// content
-	mux.HandleFunc("/counts/", h.GetCounts)
-	mux.HandleFunc("/likes/is_liked/", h.HandleIsLiked)
-	mux.HandleFunc("/likes/", h.HandleLikes)
-	mux.HandleFunc("/comments/", h.HandleComments)
-	mux.HandleFunc("/variants", h.CreateVariant)
-	mux.HandleFunc("/variants/", h.GetVariant)
-	mux.HandleFunc("/criteria", h.GetCriteria)
-
-	// result
-	mux.HandleFunc("/result/", h.CreateResult)
-	mux.HandleFunc("/result/appeal/", h.CreateAppealResult)
-	mux.HandleFunc("/users/me/results", h.GetUserResults)
-
-	// essay
-	mux.HandleFunc("/essays", h.HandleEssaysRequests)
-	mux.HandleFunc("/essays/", h.HandleEssayRequests)
-	mux.HandleFunc("/essays/appeal", h.GetAppealEssays)
-	mux.HandleFunc("/users/me/essays", h.GetUserEssays)
-	mux.HandleFunc("/users/me/essays/", h.GetUserEssayByID)
+	for _, route := range h.Routes() {
+		var handler http.Handler = middleware.Require(route.Policy, route.Handler)
+		if route.Policy.Role == middleware.RoleService {
+			// роль сервиса выдаёт проверка подписи
+			handler = h.SignatureVerifier.Middleware(handler)
+		}
+		mux.Handle(route.Pattern, handler)
+	}
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"essay/src/internal/config"
+	"essay/src/internal/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutes_Roles(t *testing.T) {
+	const (
+		anonymous = middleware.RoleAnonymous
+		user      = middleware.RoleUser
+		moderator = middleware.RoleModerator
+		admin     = middleware.RoleAdmin
+		service   = middleware.RoleService
+	)
+
+	// роль для чтения (GET) и для изменения (POST, PUT, DELETE)
+	expected := map[string]struct{ read, write middleware.Role }{
+		"/users/nickname":               {anonymous, anonymous},
+		"/users/login":                  {anonymous, anonymous},
+		"/users/logout":                 {anonymous, anonymous},
+		"/users/info":                   {user, user},
+		"/users/me/sessions":            {user, user},
+		"/users/me/sessions/":           {user, user},
+		"/users/me/password":            {user, user},
+		"/users/me/verify-email":        {user, user},
+		"/users/verify-email":           {anonymous, anonymous},
+		"/users/password-reset":         {anonymous, anonymous},
+		"/users/password-reset/confirm": {anonymous, anonymous},
+		"/users":                        {user, user},
+		"/auth/token":                   {anonymous, anonymous},
+		"/auth/revoke":                  {anonymous, anonymous},
+		"/counts/":                      {anonymous, anonymous},
+		"/likes/is_liked/":              {user, user},
+		"/likes/":                       {anonymous, user},
+		"/comments/":                    {anonymous, user},
+		"/variants":                     {admin, admin},
+		"/variants/":                    {anonymous, anonymous},
+		"/criteria":                     {anonymous, anonymous},
+		"/rubrics":                      {anonymous, anonymous},
+		"/rubrics/":                     {anonymous, moderator},
+		"/result/":                      {service, service},
+		"/result/appeal/":               {moderator, moderator},
+		"/users/me/results":             {user, user},
+		"/essays":                       {anonymous, user},
+		"/essays/":                      {anonymous, user},
+		"/essays/appeal":                {moderator, moderator},
+		"/appeals/":                     {moderator, moderator},
+		"/users/me/essays":              {user, user},
+		"/users/me/essays/":             {user, user},
+		"/exam-sessions":                {user, user},
+		"/exam-sessions/":               {user, user},
+	}
+
+	routes := NewUserHandler(nil, nil).Routes()
+	assert.Len(t, routes, len(expected))
+	for _, route := range routes {
+		t.Run(route.Pattern, func(t *testing.T) {
+			roles, ok := expected[route.Pattern]
+			if !assert.True(t, ok, "route without expected role") {
+				return
+			}
+			assert.Equal(t, roles.read, route.Policy.For(http.MethodGet))
+			for _, method := range []string{http.MethodPut, http.MethodDelete} {
+				assert.Equal(t, roles.write, route.Policy.For(method), method)
+			}
+		})
+	}
+
+	// регистрация — единственное изменение пользователей, доступное без входа
+	for _, route := range routes {
+		if route.Pattern == "/users" {
+			assert.Equal(t, anonymous, route.Policy.For(http.MethodPost))
+		} else {
+			assert.Equal(t, expected[route.Pattern].write, route.Policy.For(http.MethodPost), route.Pattern)
+		}
+	}
+}
+
+func TestRegisterRoutes_RejectsAnonymous(t *testing.T) {
+	config.InitSessionStore()
+	handler := NewUserHandler(nil, nil)
+
+	for _, path := range []string{"/users/info", "/users/me/essays", "/essays/appeal", "/variants"} {
+		rec := serveRoute(handler, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"essay/src/internal/middleware"
+	"essay/src/internal/models"
+	"essay/src/internal/services"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleUserSessions(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	now := time.Now()
+	mock.ExpectQuery(`SELECT id, COALESCE\(user_agent, ''\), COALESCE\(ip, ''\)`).
+		WithArgs(uint64(1), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_agent", "ip", "created_at", "last_seen_at", "current"}).
+			AddRow(2, "Firefox", "192.0.2.1", now, now, false))
+
+	rec := httptest.NewRecorder()
+	handler.HandleUserSessions(rec, newSessionRequest(http.MethodGet, "/users/me/sessions", 1))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var userSessions []models.UserSession
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&userSessions))
+	assert.Len(t, userSessions, 1)
+	assert.Equal(t, "Firefox", userSessions[0].UserAgent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleUserSession_OtherUser(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_session WHERE id = $1 AND user_id = $2`)).
+		WithArgs(uint64(5), uint64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec := httptest.NewRecorder()
+	handler.HandleUserSession(rec, newSessionRequest(http.MethodDelete, "/users/me/sessions/5", 1))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandleUserSessions_Bearer(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	token, err := middleware.SignToken(testTokenKey, middleware.TokenClaims{UserID: 1, ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	assert.NoError(t, err)
+	// у bearer-клиента нет текущей сессии
+	mock.ExpectQuery(`SELECT id, COALESCE\(user_agent, ''\), COALESCE\(ip, ''\)`).
+		WithArgs(uint64(1), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_agent", "ip", "created_at", "last_seen_at", "current"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := serveRoute(handler, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIssueToken_InvalidGrant(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	handler := NewUserHandler(services.NewUserService(db), nil)
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT r.id, r.family`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "family", "expired", "used", "revoked", "user_id", "is_moderator", "is_admin"}))
+	mock.ExpectRollback()
+
+	rec := httptest.NewRecorder()
+	handler.IssueToken(rec, httptest.NewRequest(http.MethodPost, "/auth/token",
+		strings.NewReader(`{"grant_type": "refresh_token", "refresh_token": "unknown"}`)))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid_grant")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}